@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"pubsub/internal/gamelogic"
+	"pubsub/internal/pubsub"
+	"pubsub/internal/routing"
+	"pubsub/internal/topology"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type recordingPublisher struct {
+	keys []string
+}
+
+func (p *recordingPublisher) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	p.keys = append(p.keys, key)
+	return nil
+}
+
+// serveWorld answers world queries from world, as the server does.
+func serveWorld(t *testing.T, world *gamelogic.World) pubsub.Broker {
+	t.Helper()
+	broker := pubsub.NewMemoryBroker()
+	t.Cleanup(func() { broker.Close() })
+	if err := topology.Provision(broker, topology.Peril()); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := pubsub.Serve(broker, routing.ExchangePerilDirect, routing.WorldQueryKey, routing.WorldQueryKey, pubsub.Durable,
+		func(ctx context.Context, q gamelogic.WorldQuery) (gamelogic.WorldView, error) {
+			return world.Query(q), nil
+		},
+		pubsub.WithExistingQueue(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sub.Close(context.Background()) })
+	return broker
+}
+
+func spawn(t *testing.T, gs *gamelogic.GameState, location, rank string) gamelogic.Unit {
+	t.Helper()
+	unit, err := gs.CommandSpawn([]string{"spawn", location, rank})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return unit
+}
+
+func TestViolationFromServerThatLostItsWorld(t *testing.T) {
+	broker := serveWorld(t, gamelogic.NewWorld())
+	gs := gamelogic.NewGameState("alice")
+	spawn(t, gs, "europe", "infantry")
+	spawn(t, gs, "asia", "cavalry")
+	pub := &recordingPublisher{}
+
+	violation := gamelogic.Violation{Username: "alice", Action: "move", Kind: gamelogic.ViolationUnknownPlayer}
+	handlerViolation(gs, broker, pub)(context.Background(), &pubsub.Delivery[gamelogic.Violation]{Body: violation})
+
+	if n := len(gs.GetPlayerSnap().Units); n != 2 {
+		t.Errorf("alice has %d units left, want 2", n)
+	}
+	if len(pub.keys) != 2 || pub.keys[0] != routing.SpawnsPrefix+".alice" {
+		t.Errorf("announced %v, want both units as spawns", pub.keys)
+	}
+}
+
+func TestViolationSyncsWithServer(t *testing.T) {
+	world := gamelogic.NewWorld()
+	gs := gamelogic.NewGameState("alice")
+	kept := spawn(t, gs, "europe", "infantry")
+	spawn(t, gs, "asia", "cavalry")
+	if err := world.ApplySpawn(gamelogic.UnitSpawned{Username: "alice", Unit: kept}); err != nil {
+		t.Fatal(err)
+	}
+	broker := serveWorld(t, world)
+	pub := &recordingPublisher{}
+
+	violation := gamelogic.Violation{Username: "alice", Action: "move", Kind: gamelogic.ViolationUnknownUnit}
+	handlerViolation(gs, broker, pub)(context.Background(), &pubsub.Delivery[gamelogic.Violation]{Body: violation})
+
+	units := gs.GetPlayerSnap().Units
+	if len(units) != 1 || units[kept.ID] != kept {
+		t.Errorf("alice has %v, want only the server's unit", units)
+	}
+	if len(pub.keys) != 0 {
+		t.Errorf("announced %v to a server that knows alice", pub.keys)
+	}
+}
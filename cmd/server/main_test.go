@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"pubsub/internal/gamelogic"
+	"pubsub/internal/pubsub"
+	"pubsub/internal/routing"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Logs written before GameLog had a kind carry no schema version and
+// must still reach handlerLog as the current type.
+func TestHandlerLogReceivesUpcastV1Logs(t *testing.T) {
+	broker := pubsub.NewMemoryBroker()
+	defer broker.Close()
+	setUpTopology(broker)
+	keys, err := pubsub.NewFileKeyStore(filepath.Join(t.TempDir(), "keys"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := keys.Provision("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	written := make(chan routing.GameLog, 1)
+	sub := setUpGameLogs(broker, pubsub.NewMemoryDedupStore(16, time.Minute), keys, handlerLog(func(gl routing.GameLog) error {
+		written <- gl
+		return nil
+	}))
+	defer sub.Close(context.Background())
+
+	v1 := routing.GameLogV1{CurrentTime: time.Now().Truncate(time.Second), Message: "alice won a war against bob", Username: "alice"}
+	body, err := json.Marshal(v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := broker.Channel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pubsub.NewSigner(ch, "alice", key).PublishWithContext(context.Background(),
+		routing.ExchangePerilTopic, routing.GameLogSlug+".alice", false, false,
+		amqp.Publishing{ContentType: pubsub.JSONCodec.ContentType(), MessageId: "v1-log", Body: body})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case gl := <-written:
+		want := routing.GameLog{CurrentTime: v1.CurrentTime, Message: v1.Message, Username: v1.Username, Kind: routing.LogKindWar}
+		if !gl.CurrentTime.Equal(want.CurrentTime) || gl.Message != want.Message || gl.Username != want.Username || gl.Kind != want.Kind {
+			t.Errorf("handlerLog got %+v, want %+v", gl, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the v1 log never reached handlerLog")
+	}
+}
+
+type discardPublisher struct{}
+
+func (discardPublisher) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	return nil
+}
+
+// A player's key must not let them act for another player.
+func TestWorldEventsMustBeSignedByTheirPlayer(t *testing.T) {
+	broker := pubsub.NewMemoryBroker()
+	defer broker.Close()
+	setUpTopology(broker)
+	dir := t.TempDir()
+	keys, err := pubsub.NewFileKeyStore(filepath.Join(dir, "keys"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := keys.Provision("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	world := gamelogic.NewWorld()
+	events, queries := setUpWorld(broker, world, filepath.Join(dir, "world.json"), discardPublisher{}, keys, pubsub.NewMemoryDedupStore(16, time.Minute))
+	defer events.Close(context.Background())
+	defer queries.Close(context.Background())
+
+	ch, err := broker.Channel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := pubsub.NewSigner(ch, "alice", key)
+	for _, username := range []string{"bob", "alice"} {
+		ev := gamelogic.UnitSpawned{Username: username, Unit: gamelogic.Unit{ID: 1, Rank: gamelogic.RankInfantry, Location: "europe"}}
+		err := pubsub.Publish(alice, pubsub.ProtobufCodec, routing.ExchangePerilTopic, routing.SpawnsPrefix+"."+username, ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := world.Player("alice"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("alice's own spawn was not applied")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, ok := world.Player("bob"); ok {
+		t.Error("alice spawned a unit for bob")
+	}
+}
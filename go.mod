@@ -1,7 +1,17 @@
 module pubsub
 
-go 1.22.3
+go 1.23
 
-require github.com/bootdotdev/learn-pub-sub-starter v0.0.0-20240418195929-d612d5b298fd
+require github.com/rabbitmq/amqp091-go v1.10.0
 
-require github.com/rabbitmq/amqp091-go v1.10.0 // indirect
+require (
+	github.com/fxamacker/cbor/v2 v2.9.4
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	google.golang.org/protobuf v1.36.12
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+)
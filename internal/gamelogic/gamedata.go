@@ -1,5 +1,7 @@
 package gamelogic
 
+import "pubsub/internal/routing"
+
 type Player struct {
 	Username string
 	Units    map[int]Unit
@@ -30,6 +32,36 @@ type RecognitionOfWar struct {
 	Defender Player
 }
 
+// UnitSpawned reports a unit a player added to the world.
+type UnitSpawned struct {
+	Username string
+	Unit     Unit
+}
+
+// WorldQuery asks the server about the world. An empty field matches
+// everything.
+type WorldQuery struct {
+	Username string
+	Location Location
+}
+
+type WorldView struct {
+	Players []Player
+}
+
+// WarResolution is the server's verdict on a war between the attacker,
+// who moved into Location, and the defender already there. Winner and
+// Loser are empty on a draw. Killed lists the IDs of the units each
+// player lost.
+type WarResolution struct {
+	Attacker string
+	Defender string
+	Location Location
+	Winner   string
+	Loser    string
+	Killed   map[string][]int
+}
+
 type Location string
 
 func getAllRanks() map[UnitRank]struct{} {
@@ -50,3 +82,15 @@ func getAllLocations() map[Location]struct{} {
 		"antarctica": {},
 	}
 }
+
+// Headers describes the move for routing on routing.ExchangePerilHeaders.
+func (mv ArmyMove) Headers() map[string]any {
+	headers := map[string]any{
+		routing.HeaderPlayer:   mv.Player.Username,
+		routing.HeaderLocation: string(mv.ToLocation),
+	}
+	for _, unit := range mv.Units {
+		headers[routing.HeaderRankPrefix+string(unit.Rank)] = true
+	}
+	return headers
+}
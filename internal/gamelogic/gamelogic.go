@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"slices"
 	"strings"
 )
 
@@ -18,6 +19,9 @@ func PrintClientHelp() {
 	fmt.Println("    example:")
 	fmt.Println("    spawn europe infantry")
 	fmt.Println("* status")
+	fmt.Println("* world [location]")
+	fmt.Println("    example:")
+	fmt.Println("    world asia")
 	fmt.Println("* spam <n>")
 	fmt.Println("    example:")
 	fmt.Println("    spam 5")
@@ -42,6 +46,8 @@ func PrintServerHelp() {
 	fmt.Println("Possible commands:")
 	fmt.Println("* pause")
 	fmt.Println("* resume")
+	fmt.Println("* world")
+	fmt.Println("* issue <username>")
 	fmt.Println("* quit")
 	fmt.Println("* help")
 }
@@ -90,3 +96,23 @@ func (gs *GameState) CommandStatus() {
 		fmt.Printf("* %v: %v, %v\n", unit.ID, unit.Location, unit.Rank)
 	}
 }
+
+// PrintWorld shows what the server knows about the players' units.
+func PrintWorld(view WorldView) {
+	if len(view.Players) == 0 {
+		fmt.Println("Nobody has spawned any units yet.")
+		return
+	}
+	for _, player := range view.Players {
+		fmt.Printf("%s:\n", player.Username)
+		ids := make([]int, 0, len(player.Units))
+		for id := range player.Units {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+		for _, id := range ids {
+			unit := player.Units[id]
+			fmt.Printf("  * %v: %v, %v\n", unit.ID, unit.Location, unit.Rank)
+		}
+	}
+}
@@ -55,6 +55,14 @@ func (gs *GameState) removeUnitsInLocation(loc Location) {
 	}
 }
 
+func (gs *GameState) removeUnits(ids []int) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	for _, id := range ids {
+		delete(gs.Player.Units, id)
+	}
+}
+
 func (gs *GameState) UpdateUnit(u Unit) {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
@@ -5,30 +5,37 @@ import (
 	"fmt"
 )
 
-func (gs *GameState) CommandSpawn(words []string) error {
+// CommandSpawn adds a unit and returns it, so that the spawn can be
+// reported to the server.
+func (gs *GameState) CommandSpawn(words []string) (Unit, error) {
 	if len(words) < 3 {
-		return errors.New("usage: spawn <location> <rank>")
+		return Unit{}, errors.New("usage: spawn <location> <rank>")
 	}
 
 	locationName := words[1]
 	locations := getAllLocations()
 	if _, ok := locations[Location(locationName)]; !ok {
-		return fmt.Errorf("error: %s is not a valid location", locationName)
+		return Unit{}, fmt.Errorf("error: %s is not a valid location", locationName)
 	}
 
 	rank := words[2]
 	units := getAllRanks()
 	if _, ok := units[UnitRank(rank)]; !ok {
-		return fmt.Errorf("error: %s is not a valid unit", rank)
+		return Unit{}, fmt.Errorf("error: %s is not a valid unit", rank)
 	}
 
-	id := len(gs.getUnitsSnap()) + 1
-	gs.addUnit(Unit{
+	// Counting the units would hand out the ID of a survivor after a war.
+	id := 1
+	for _, u := range gs.getUnitsSnap() {
+		id = max(id, u.ID+1)
+	}
+	unit := Unit{
 		ID:       id,
 		Rank:     UnitRank(rank),
 		Location: Location(locationName),
-	})
+	}
+	gs.addUnit(unit)
 
 	fmt.Printf("Spawned a(n) %s in %s with id %v\n", rank, locationName, id)
-	return nil
+	return unit, nil
 }
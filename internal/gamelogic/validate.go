@@ -0,0 +1,102 @@
+package gamelogic
+
+import "fmt"
+
+type ViolationKind string
+
+const (
+	ViolationUnknownPlayer      ViolationKind = "unknown_player"
+	ViolationUnknownUnit        ViolationKind = "unknown_unit"
+	ViolationFabricatedUnit     ViolationKind = "fabricated_unit"
+	ViolationDuplicateUnit      ViolationKind = "duplicate_unit"
+	ViolationImpossibleLocation ViolationKind = "impossible_location"
+	ViolationInvalidRank        ViolationKind = "invalid_rank"
+)
+
+// Violation explains why the world rejected a player's spawn or move. It
+// is published to the audit stream and to the offending player.
+type Violation struct {
+	Username string
+	// Action is "spawn" or "move".
+	Action string
+	Kind   ViolationKind
+	Detail string
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("%s by %s rejected (%s): %s", v.Action, v.Username, v.Kind, v.Detail)
+}
+
+func (v *Violation) Unwrap() error {
+	return ErrContradiction
+}
+
+func violation(username, action string, kind ViolationKind, format string, args ...any) *Violation {
+	return &Violation{Username: username, Action: action, Kind: kind, Detail: fmt.Sprintf(format, args...)}
+}
+
+// validateSpawn checks a spawn against the world. The lock must be held.
+func (w *World) validateSpawn(ev UnitSpawned) *Violation {
+	if _, ok := getAllLocations()[ev.Unit.Location]; !ok {
+		return violation(ev.Username, "spawn", ViolationImpossibleLocation, "%q is not a location", ev.Unit.Location)
+	}
+	if _, ok := getAllRanks()[ev.Unit.Rank]; !ok {
+		return violation(ev.Username, "spawn", ViolationInvalidRank, "%q is not a rank", ev.Unit.Rank)
+	}
+	if _, ok := w.players[ev.Username][ev.Unit.ID]; ok {
+		return violation(ev.Username, "spawn", ViolationDuplicateUnit, "unit %d already exists", ev.Unit.ID)
+	}
+	return nil
+}
+
+// validateMove checks both the moved units and the player snapshot a
+// move carries, since clients read both. Each unit must exist in the
+// world with the same rank, and be either where the world has it or at
+// the destination. The lock must be held.
+func (w *World) validateMove(move ArmyMove) *Violation {
+	username := move.Player.Username
+	units, ok := w.players[username]
+	if !ok {
+		return violation(username, "move", ViolationUnknownPlayer, "%s has not spawned any units", username)
+	}
+	if _, ok := getAllLocations()[move.ToLocation]; !ok {
+		return violation(username, "move", ViolationImpossibleLocation, "%q is not a location", move.ToLocation)
+	}
+	claimed := append([]Unit{}, move.Units...)
+	for _, u := range move.Player.Units {
+		claimed = append(claimed, u)
+	}
+	for _, u := range claimed {
+		known, ok := units[u.ID]
+		if !ok {
+			return violation(username, "move", ViolationUnknownUnit, "unit %d does not exist", u.ID)
+		}
+		if u.Rank != known.Rank {
+			return violation(username, "move", ViolationFabricatedUnit, "unit %d is %s, not %s", u.ID, known.Rank, u.Rank)
+		}
+		if u.Location != known.Location && u.Location != move.ToLocation {
+			return violation(username, "move", ViolationFabricatedUnit, "unit %d is in %s, not %s", u.ID, known.Location, u.Location)
+		}
+	}
+	return nil
+}
+
+// HandleViolation tells the player that the server rejected one of their
+// actions.
+func (gs *GameState) HandleViolation(v Violation) {
+	defer fmt.Println("------------------------")
+	fmt.Println()
+	fmt.Println("==== Action Rejected ====")
+	fmt.Printf("The server rejected your %s: %s (%s)\n", v.Action, v.Detail, v.Kind)
+}
+
+// SyncUnits replaces the player's units with the server's record of them.
+func (gs *GameState) SyncUnits(p Player) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.Player.Units = map[int]Unit{}
+	for id, u := range p.Units {
+		gs.Player.Units[id] = u
+	}
+	fmt.Printf("Your units were synced with the server: you have %d unit(s).\n", len(p.Units))
+}
@@ -103,3 +103,31 @@ func unitsToPowerLevel(units []Unit) int {
 	}
 	return power
 }
+
+// HandleWarResolution applies the server's verdict on a war to the local
+// player, removing the units it lost.
+func (gs *GameState) HandleWarResolution(wr WarResolution) WarOutcome {
+	defer fmt.Println("------------------------")
+	fmt.Println()
+	fmt.Println("==== War Resolved ====")
+	fmt.Printf("%s attacked %s in %s.\n", wr.Attacker, wr.Defender, wr.Location)
+
+	username := gs.GetUsername()
+	if username != wr.Attacker && username != wr.Defender {
+		fmt.Printf("%s, you are not involved in this war.\n", username)
+		return WarOutcomeNotInvolved
+	}
+	gs.removeUnits(wr.Killed[username])
+	switch wr.Winner {
+	case "":
+		fmt.Println("The war ended in a draw!")
+		fmt.Printf("Your units in %s have been killed.\n", wr.Location)
+		return WarOutcomeDraw
+	case username:
+		fmt.Println("You have won the war!")
+		return WarOutcomeYouWon
+	}
+	fmt.Println("You have lost the war!")
+	fmt.Printf("Your units in %s have been killed.\n", wr.Location)
+	return WarOutcomeOpponentWon
+}
@@ -0,0 +1,200 @@
+package gamelogic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+)
+
+// ErrContradiction is returned for actions that do not agree with the
+// world, such as moving a unit the player never spawned.
+var ErrContradiction = errors.New("action contradicts the world state")
+
+// World is the server's authoritative view of every player's units, built
+// from spawn, move and war events. Wars are fought against it once,
+// instead of by each client on its own data.
+type World struct {
+	mu      sync.RWMutex
+	players map[string]map[int]Unit
+}
+
+func NewWorld() *World {
+	return &World{players: map[string]map[int]Unit{}}
+}
+
+// LoadWorld restores a world written by Save. Without a file the world
+// starts out empty.
+func LoadWorld(path string) (*World, error) {
+	w := NewWorld()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return w, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Reading world failed: %w", err)
+	}
+	var view WorldView
+	if err := json.Unmarshal(data, &view); err != nil {
+		return nil, fmt.Errorf("Reading world failed: %w", err)
+	}
+	for _, p := range view.Players {
+		units := map[int]Unit{}
+		for id, u := range p.Units {
+			units[id] = u
+		}
+		w.players[p.Username] = units
+	}
+	return w, nil
+}
+
+// Save writes a snapshot of the world to path. The file is replaced in
+// one step, so a crash never leaves half a world behind.
+func (w *World) Save(path string) error {
+	data, err := json.Marshal(w.Query(WorldQuery{}))
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("Writing world failed: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("Writing world failed: %w", err)
+	}
+	return nil
+}
+
+// ApplySpawn adds the unit to its player, who joins the world with their
+// first spawn. An invalid spawn is rejected with a *Violation.
+func (w *World) ApplySpawn(ev UnitSpawned) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if v := w.validateSpawn(ev); v != nil {
+		return v
+	}
+	units, ok := w.players[ev.Username]
+	if !ok {
+		units = map[int]Unit{}
+		w.players[ev.Username] = units
+	}
+	units[ev.Unit.ID] = ev.Unit
+	return nil
+}
+
+// ApplyMove moves the player's units that the move puts in its
+// destination, then fights a war with every player who has units there,
+// taking the players by username. A move that does not agree with the
+// world is rejected as a whole with a *Violation.
+func (w *World) ApplyMove(move ArmyMove) ([]WarResolution, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if v := w.validateMove(move); v != nil {
+		return nil, v
+	}
+	attacker := move.Player.Username
+	units := w.players[attacker]
+	for _, u := range move.Units {
+		if u.Location == move.ToLocation {
+			unit := units[u.ID]
+			unit.Location = move.ToLocation
+			units[u.ID] = unit
+		}
+	}
+
+	resolutions := []WarResolution{}
+	for _, defender := range w.playerNames() {
+		if defender == attacker {
+			continue
+		}
+		if len(w.unitsAt(defender, move.ToLocation)) == 0 || len(w.unitsAt(attacker, move.ToLocation)) == 0 {
+			continue
+		}
+		resolutions = append(resolutions, w.fight(attacker, defender, move.ToLocation))
+	}
+	return resolutions, nil
+}
+
+// fight resolves one war with unitsToPowerLevel and removes the dead
+// units. The lock must be held.
+func (w *World) fight(attacker, defender string, loc Location) WarResolution {
+	attackerUnits := w.unitsAt(attacker, loc)
+	defenderUnits := w.unitsAt(defender, loc)
+	wr := WarResolution{
+		Attacker: attacker,
+		Defender: defender,
+		Location: loc,
+		Killed:   map[string][]int{},
+	}
+	attackerPower := unitsToPowerLevel(attackerUnits)
+	defenderPower := unitsToPowerLevel(defenderUnits)
+	switch {
+	case attackerPower > defenderPower:
+		wr.Winner, wr.Loser = attacker, defender
+	case defenderPower > attackerPower:
+		wr.Winner, wr.Loser = defender, attacker
+	}
+	for _, player := range []string{attacker, defender} {
+		if wr.Winner == player {
+			continue
+		}
+		for _, u := range w.unitsAt(player, loc) {
+			delete(w.players[player], u.ID)
+			wr.Killed[player] = append(wr.Killed[player], u.ID)
+		}
+		slices.Sort(wr.Killed[player])
+	}
+	return wr
+}
+
+// Query returns the players matching q, with only their units in
+// q.Location if it is set.
+func (w *World) Query(q WorldQuery) WorldView {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	view := WorldView{Players: []Player{}}
+	for _, username := range w.playerNames() {
+		if q.Username != "" && q.Username != username {
+			continue
+		}
+		player := Player{Username: username, Units: map[int]Unit{}}
+		for id, u := range w.players[username] {
+			if q.Location == "" || q.Location == u.Location {
+				player.Units[id] = u
+			}
+		}
+		view.Players = append(view.Players, player)
+	}
+	return view
+}
+
+// Player returns a copy of a player's units as the world knows them.
+func (w *World) Player(username string) (Player, bool) {
+	view := w.Query(WorldQuery{Username: username})
+	if len(view.Players) == 0 {
+		return Player{}, false
+	}
+	return view.Players[0], true
+}
+
+// unitsAt returns a player's units in loc. The lock must be held.
+func (w *World) unitsAt(username string, loc Location) []Unit {
+	units := []Unit{}
+	for _, u := range w.players[username] {
+		if u.Location == loc {
+			units = append(units, u)
+		}
+	}
+	return units
+}
+
+func (w *World) playerNames() []string {
+	names := make([]string, 0, len(w.players))
+	for name := range w.players {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,41 @@
+package gamelogic
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWorldSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "world.json")
+	world, err := LoadWorld(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ev := range []UnitSpawned{
+		{Username: "alice", Unit: Unit{ID: 1, Rank: RankInfantry, Location: "europe"}},
+		{Username: "alice", Unit: Unit{ID: 2, Rank: RankArtillery, Location: "asia"}},
+		{Username: "bob", Unit: Unit{ID: 1, Rank: RankCavalry, Location: "africa"}},
+	} {
+		if err := world.ApplySpawn(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := world.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted, err := LoadWorld(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := world.Query(WorldQuery{})
+	if got := restarted.Query(WorldQuery{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("restarted world is %+v, want %+v", got, want)
+	}
+	alice, _ := restarted.Player("alice")
+	_, err = restarted.ApplyMove(ArmyMove{Player: alice, Units: []Unit{alice.Units[1]}, ToLocation: "africa"})
+	if err != nil {
+		t.Errorf("move of a restored unit was rejected: %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+package perilpb
+
+import (
+	"pubsub/internal/gamelogic"
+	"pubsub/internal/pubsub"
+	"pubsub/internal/routing"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Registering the conversions lets the game keep publishing and handling
+// its own structs while they travel as protobuf.
+func init() {
+	pubsub.RegisterProtoConversion(pubsub.ProtobufCodec, FromPlayingState, (*PlayingState).ToPlayingState)
+	pubsub.RegisterProtoConversion(pubsub.ProtobufCodec, FromGameLog, (*GameLog).ToGameLog)
+	pubsub.RegisterProtoConversion(pubsub.ProtobufCodec, FromGameLogV1, (*GameLog).ToGameLogV1)
+	pubsub.RegisterProtoConversion(pubsub.ProtobufCodec, FromArmyMove, (*ArmyMove).ToArmyMove)
+	pubsub.RegisterProtoConversion(pubsub.ProtobufCodec, FromRecognitionOfWar, (*RecognitionOfWar).ToRecognitionOfWar)
+	pubsub.RegisterProtoConversion(pubsub.ProtobufCodec, FromWarResolution, (*WarResolution).ToWarResolution)
+	pubsub.RegisterProtoConversion(pubsub.ProtobufCodec, FromUnitSpawned, (*UnitSpawned).ToUnitSpawned)
+	pubsub.RegisterProtoConversion(pubsub.ProtobufCodec, FromViolation, (*Violation).ToViolation)
+}
+
+func FromPlayingState(ps routing.PlayingState) *PlayingState {
+	return &PlayingState{IsPaused: ps.IsPaused}
+}
+
+func (x *PlayingState) ToPlayingState() routing.PlayingState {
+	return routing.PlayingState{IsPaused: x.GetIsPaused()}
+}
+
+var logKinds = map[routing.LogKind]LogKind{
+	routing.LogKindWar:  LogKind_LOG_KIND_WAR,
+	routing.LogKindSpam: LogKind_LOG_KIND_SPAM,
+}
+
+func FromGameLog(gl routing.GameLog) *GameLog {
+	return &GameLog{
+		CurrentTime: timestamppb.New(gl.CurrentTime),
+		Message:     gl.Message,
+		Username:    gl.Username,
+		Kind:        logKinds[gl.Kind],
+	}
+}
+
+func (x *GameLog) ToGameLog() routing.GameLog {
+	gl := routing.GameLog{Message: x.GetMessage(), Username: x.GetUsername()}
+	if x.GetCurrentTime() != nil {
+		gl.CurrentTime = x.GetCurrentTime().AsTime()
+	}
+	for kind, pb := range logKinds {
+		if pb == x.GetKind() {
+			gl.Kind = kind
+		}
+	}
+	return gl
+}
+
+func FromGameLogV1(gl routing.GameLogV1) *GameLog {
+	return &GameLog{
+		CurrentTime: timestamppb.New(gl.CurrentTime),
+		Message:     gl.Message,
+		Username:    gl.Username,
+	}
+}
+
+func (x *GameLog) ToGameLogV1() routing.GameLogV1 {
+	gl := routing.GameLogV1{Message: x.GetMessage(), Username: x.GetUsername()}
+	if x.GetCurrentTime() != nil {
+		gl.CurrentTime = x.GetCurrentTime().AsTime()
+	}
+	return gl
+}
+
+var ranks = map[gamelogic.UnitRank]UnitRank{
+	gamelogic.RankInfantry:  UnitRank_UNIT_RANK_INFANTRY,
+	gamelogic.RankCavalry:   UnitRank_UNIT_RANK_CAVALRY,
+	gamelogic.RankArtillery: UnitRank_UNIT_RANK_ARTILLERY,
+}
+
+func FromUnit(u gamelogic.Unit) *Unit {
+	return &Unit{
+		Id:       int64(u.ID),
+		Rank:     ranks[u.Rank],
+		Location: string(u.Location),
+	}
+}
+
+func (x *Unit) ToUnit() gamelogic.Unit {
+	u := gamelogic.Unit{ID: int(x.GetId()), Location: gamelogic.Location(x.GetLocation())}
+	for rank, pb := range ranks {
+		if pb == x.GetRank() {
+			u.Rank = rank
+		}
+	}
+	return u
+}
+
+func FromPlayer(p gamelogic.Player) *Player {
+	units := make(map[int64]*Unit, len(p.Units))
+	for id, u := range p.Units {
+		units[int64(id)] = FromUnit(u)
+	}
+	return &Player{Username: p.Username, Units: units}
+}
+
+func (x *Player) ToPlayer() gamelogic.Player {
+	units := make(map[int]gamelogic.Unit, len(x.GetUnits()))
+	for id, u := range x.GetUnits() {
+		units[int(id)] = u.ToUnit()
+	}
+	return gamelogic.Player{Username: x.GetUsername(), Units: units}
+}
+
+func FromArmyMove(am gamelogic.ArmyMove) *ArmyMove {
+	units := make([]*Unit, len(am.Units))
+	for i, u := range am.Units {
+		units[i] = FromUnit(u)
+	}
+	return &ArmyMove{
+		Player:     FromPlayer(am.Player),
+		Units:      units,
+		ToLocation: string(am.ToLocation),
+	}
+}
+
+func (x *ArmyMove) ToArmyMove() gamelogic.ArmyMove {
+	units := make([]gamelogic.Unit, len(x.GetUnits()))
+	for i, u := range x.GetUnits() {
+		units[i] = u.ToUnit()
+	}
+	return gamelogic.ArmyMove{
+		Player:     x.GetPlayer().ToPlayer(),
+		Units:      units,
+		ToLocation: gamelogic.Location(x.GetToLocation()),
+	}
+}
+
+func FromRecognitionOfWar(rw gamelogic.RecognitionOfWar) *RecognitionOfWar {
+	return &RecognitionOfWar{
+		Attacker: FromPlayer(rw.Attacker),
+		Defender: FromPlayer(rw.Defender),
+	}
+}
+
+func (x *RecognitionOfWar) ToRecognitionOfWar() gamelogic.RecognitionOfWar {
+	return gamelogic.RecognitionOfWar{
+		Attacker: x.GetAttacker().ToPlayer(),
+		Defender: x.GetDefender().ToPlayer(),
+	}
+}
+
+func FromWarResolution(wr gamelogic.WarResolution) *WarResolution {
+	killed := make(map[string]*UnitIds, len(wr.Killed))
+	for username, ids := range wr.Killed {
+		pb := &UnitIds{Ids: make([]int64, len(ids))}
+		for i, id := range ids {
+			pb.Ids[i] = int64(id)
+		}
+		killed[username] = pb
+	}
+	return &WarResolution{
+		Attacker: wr.Attacker,
+		Defender: wr.Defender,
+		Location: string(wr.Location),
+		Winner:   wr.Winner,
+		Loser:    wr.Loser,
+		Killed:   killed,
+	}
+}
+
+func (x *WarResolution) ToWarResolution() gamelogic.WarResolution {
+	killed := make(map[string][]int, len(x.GetKilled()))
+	for username, pb := range x.GetKilled() {
+		ids := make([]int, len(pb.GetIds()))
+		for i, id := range pb.GetIds() {
+			ids[i] = int(id)
+		}
+		killed[username] = ids
+	}
+	return gamelogic.WarResolution{
+		Attacker: x.GetAttacker(),
+		Defender: x.GetDefender(),
+		Location: gamelogic.Location(x.GetLocation()),
+		Winner:   x.GetWinner(),
+		Loser:    x.GetLoser(),
+		Killed:   killed,
+	}
+}
+
+func FromUnitSpawned(ev gamelogic.UnitSpawned) *UnitSpawned {
+	return &UnitSpawned{Username: ev.Username, Unit: FromUnit(ev.Unit)}
+}
+
+func (x *UnitSpawned) ToUnitSpawned() gamelogic.UnitSpawned {
+	ev := gamelogic.UnitSpawned{Username: x.GetUsername()}
+	if x.GetUnit() != nil {
+		ev.Unit = x.GetUnit().ToUnit()
+	}
+	return ev
+}
+
+var violationKinds = map[gamelogic.ViolationKind]ViolationKind{
+	gamelogic.ViolationUnknownPlayer:      ViolationKind_VIOLATION_KIND_UNKNOWN_PLAYER,
+	gamelogic.ViolationUnknownUnit:        ViolationKind_VIOLATION_KIND_UNKNOWN_UNIT,
+	gamelogic.ViolationFabricatedUnit:     ViolationKind_VIOLATION_KIND_FABRICATED_UNIT,
+	gamelogic.ViolationDuplicateUnit:      ViolationKind_VIOLATION_KIND_DUPLICATE_UNIT,
+	gamelogic.ViolationImpossibleLocation: ViolationKind_VIOLATION_KIND_IMPOSSIBLE_LOCATION,
+	gamelogic.ViolationInvalidRank:        ViolationKind_VIOLATION_KIND_INVALID_RANK,
+}
+
+func FromViolation(v gamelogic.Violation) *Violation {
+	return &Violation{
+		Username: v.Username,
+		Action:   v.Action,
+		Kind:     violationKinds[v.Kind],
+		Detail:   v.Detail,
+	}
+}
+
+func (x *Violation) ToViolation() gamelogic.Violation {
+	v := gamelogic.Violation{Username: x.GetUsername(), Action: x.GetAction(), Detail: x.GetDetail()}
+	for kind, pb := range violationKinds {
+		if pb == x.GetKind() {
+			v.Kind = kind
+		}
+	}
+	return v
+}
@@ -0,0 +1,921 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: peril/v1/peril.proto
+
+package perilpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type LogKind int32
+
+const (
+	LogKind_LOG_KIND_UNSPECIFIED LogKind = 0
+	LogKind_LOG_KIND_WAR         LogKind = 1
+	LogKind_LOG_KIND_SPAM        LogKind = 2
+)
+
+// Enum value maps for LogKind.
+var (
+	LogKind_name = map[int32]string{
+		0: "LOG_KIND_UNSPECIFIED",
+		1: "LOG_KIND_WAR",
+		2: "LOG_KIND_SPAM",
+	}
+	LogKind_value = map[string]int32{
+		"LOG_KIND_UNSPECIFIED": 0,
+		"LOG_KIND_WAR":         1,
+		"LOG_KIND_SPAM":        2,
+	}
+)
+
+func (x LogKind) Enum() *LogKind {
+	p := new(LogKind)
+	*p = x
+	return p
+}
+
+func (x LogKind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (LogKind) Descriptor() protoreflect.EnumDescriptor {
+	return file_peril_v1_peril_proto_enumTypes[0].Descriptor()
+}
+
+func (LogKind) Type() protoreflect.EnumType {
+	return &file_peril_v1_peril_proto_enumTypes[0]
+}
+
+func (x LogKind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use LogKind.Descriptor instead.
+func (LogKind) EnumDescriptor() ([]byte, []int) {
+	return file_peril_v1_peril_proto_rawDescGZIP(), []int{0}
+}
+
+type UnitRank int32
+
+const (
+	UnitRank_UNIT_RANK_UNSPECIFIED UnitRank = 0
+	UnitRank_UNIT_RANK_INFANTRY    UnitRank = 1
+	UnitRank_UNIT_RANK_CAVALRY     UnitRank = 2
+	UnitRank_UNIT_RANK_ARTILLERY   UnitRank = 3
+)
+
+// Enum value maps for UnitRank.
+var (
+	UnitRank_name = map[int32]string{
+		0: "UNIT_RANK_UNSPECIFIED",
+		1: "UNIT_RANK_INFANTRY",
+		2: "UNIT_RANK_CAVALRY",
+		3: "UNIT_RANK_ARTILLERY",
+	}
+	UnitRank_value = map[string]int32{
+		"UNIT_RANK_UNSPECIFIED": 0,
+		"UNIT_RANK_INFANTRY":    1,
+		"UNIT_RANK_CAVALRY":     2,
+		"UNIT_RANK_ARTILLERY":   3,
+	}
+)
+
+func (x UnitRank) Enum() *UnitRank {
+	p := new(UnitRank)
+	*p = x
+	return p
+}
+
+func (x UnitRank) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (UnitRank) Descriptor() protoreflect.EnumDescriptor {
+	return file_peril_v1_peril_proto_enumTypes[1].Descriptor()
+}
+
+func (UnitRank) Type() protoreflect.EnumType {
+	return &file_peril_v1_peril_proto_enumTypes[1]
+}
+
+func (x UnitRank) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use UnitRank.Descriptor instead.
+func (UnitRank) EnumDescriptor() ([]byte, []int) {
+	return file_peril_v1_peril_proto_rawDescGZIP(), []int{1}
+}
+
+type ViolationKind int32
+
+const (
+	ViolationKind_VIOLATION_KIND_UNSPECIFIED         ViolationKind = 0
+	ViolationKind_VIOLATION_KIND_UNKNOWN_PLAYER      ViolationKind = 1
+	ViolationKind_VIOLATION_KIND_UNKNOWN_UNIT        ViolationKind = 2
+	ViolationKind_VIOLATION_KIND_FABRICATED_UNIT     ViolationKind = 3
+	ViolationKind_VIOLATION_KIND_DUPLICATE_UNIT      ViolationKind = 4
+	ViolationKind_VIOLATION_KIND_IMPOSSIBLE_LOCATION ViolationKind = 5
+	ViolationKind_VIOLATION_KIND_INVALID_RANK        ViolationKind = 6
+)
+
+// Enum value maps for ViolationKind.
+var (
+	ViolationKind_name = map[int32]string{
+		0: "VIOLATION_KIND_UNSPECIFIED",
+		1: "VIOLATION_KIND_UNKNOWN_PLAYER",
+		2: "VIOLATION_KIND_UNKNOWN_UNIT",
+		3: "VIOLATION_KIND_FABRICATED_UNIT",
+		4: "VIOLATION_KIND_DUPLICATE_UNIT",
+		5: "VIOLATION_KIND_IMPOSSIBLE_LOCATION",
+		6: "VIOLATION_KIND_INVALID_RANK",
+	}
+	ViolationKind_value = map[string]int32{
+		"VIOLATION_KIND_UNSPECIFIED":         0,
+		"VIOLATION_KIND_UNKNOWN_PLAYER":      1,
+		"VIOLATION_KIND_UNKNOWN_UNIT":        2,
+		"VIOLATION_KIND_FABRICATED_UNIT":     3,
+		"VIOLATION_KIND_DUPLICATE_UNIT":      4,
+		"VIOLATION_KIND_IMPOSSIBLE_LOCATION": 5,
+		"VIOLATION_KIND_INVALID_RANK":        6,
+	}
+)
+
+func (x ViolationKind) Enum() *ViolationKind {
+	p := new(ViolationKind)
+	*p = x
+	return p
+}
+
+func (x ViolationKind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ViolationKind) Descriptor() protoreflect.EnumDescriptor {
+	return file_peril_v1_peril_proto_enumTypes[2].Descriptor()
+}
+
+func (ViolationKind) Type() protoreflect.EnumType {
+	return &file_peril_v1_peril_proto_enumTypes[2]
+}
+
+func (x ViolationKind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ViolationKind.Descriptor instead.
+func (ViolationKind) EnumDescriptor() ([]byte, []int) {
+	return file_peril_v1_peril_proto_rawDescGZIP(), []int{2}
+}
+
+type PlayingState struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	IsPaused      bool                   `protobuf:"varint,1,opt,name=is_paused,json=isPaused,proto3" json:"is_paused,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PlayingState) Reset() {
+	*x = PlayingState{}
+	mi := &file_peril_v1_peril_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PlayingState) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PlayingState) ProtoMessage() {}
+
+func (x *PlayingState) ProtoReflect() protoreflect.Message {
+	mi := &file_peril_v1_peril_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PlayingState.ProtoReflect.Descriptor instead.
+func (*PlayingState) Descriptor() ([]byte, []int) {
+	return file_peril_v1_peril_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *PlayingState) GetIsPaused() bool {
+	if x != nil {
+		return x.IsPaused
+	}
+	return false
+}
+
+type GameLog struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	CurrentTime *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=current_time,json=currentTime,proto3" json:"current_time,omitempty"`
+	Message     string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Username    string                 `protobuf:"bytes,3,opt,name=username,proto3" json:"username,omitempty"`
+	// Added in schema version 2.
+	Kind          LogKind `protobuf:"varint,4,opt,name=kind,proto3,enum=peril.v1.LogKind" json:"kind,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GameLog) Reset() {
+	*x = GameLog{}
+	mi := &file_peril_v1_peril_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GameLog) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GameLog) ProtoMessage() {}
+
+func (x *GameLog) ProtoReflect() protoreflect.Message {
+	mi := &file_peril_v1_peril_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GameLog.ProtoReflect.Descriptor instead.
+func (*GameLog) Descriptor() ([]byte, []int) {
+	return file_peril_v1_peril_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GameLog) GetCurrentTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CurrentTime
+	}
+	return nil
+}
+
+func (x *GameLog) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *GameLog) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *GameLog) GetKind() LogKind {
+	if x != nil {
+		return x.Kind
+	}
+	return LogKind_LOG_KIND_UNSPECIFIED
+}
+
+type Unit struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Rank          UnitRank               `protobuf:"varint,2,opt,name=rank,proto3,enum=peril.v1.UnitRank" json:"rank,omitempty"`
+	Location      string                 `protobuf:"bytes,3,opt,name=location,proto3" json:"location,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Unit) Reset() {
+	*x = Unit{}
+	mi := &file_peril_v1_peril_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Unit) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Unit) ProtoMessage() {}
+
+func (x *Unit) ProtoReflect() protoreflect.Message {
+	mi := &file_peril_v1_peril_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Unit.ProtoReflect.Descriptor instead.
+func (*Unit) Descriptor() ([]byte, []int) {
+	return file_peril_v1_peril_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Unit) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Unit) GetRank() UnitRank {
+	if x != nil {
+		return x.Rank
+	}
+	return UnitRank_UNIT_RANK_UNSPECIFIED
+}
+
+func (x *Unit) GetLocation() string {
+	if x != nil {
+		return x.Location
+	}
+	return ""
+}
+
+type Player struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Username string                 `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	// Keyed by unit id.
+	Units         map[int64]*Unit `protobuf:"bytes,2,rep,name=units,proto3" json:"units,omitempty" protobuf_key:"varint,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Player) Reset() {
+	*x = Player{}
+	mi := &file_peril_v1_peril_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Player) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Player) ProtoMessage() {}
+
+func (x *Player) ProtoReflect() protoreflect.Message {
+	mi := &file_peril_v1_peril_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Player.ProtoReflect.Descriptor instead.
+func (*Player) Descriptor() ([]byte, []int) {
+	return file_peril_v1_peril_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Player) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *Player) GetUnits() map[int64]*Unit {
+	if x != nil {
+		return x.Units
+	}
+	return nil
+}
+
+type ArmyMove struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Player        *Player                `protobuf:"bytes,1,opt,name=player,proto3" json:"player,omitempty"`
+	Units         []*Unit                `protobuf:"bytes,2,rep,name=units,proto3" json:"units,omitempty"`
+	ToLocation    string                 `protobuf:"bytes,3,opt,name=to_location,json=toLocation,proto3" json:"to_location,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ArmyMove) Reset() {
+	*x = ArmyMove{}
+	mi := &file_peril_v1_peril_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ArmyMove) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ArmyMove) ProtoMessage() {}
+
+func (x *ArmyMove) ProtoReflect() protoreflect.Message {
+	mi := &file_peril_v1_peril_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ArmyMove.ProtoReflect.Descriptor instead.
+func (*ArmyMove) Descriptor() ([]byte, []int) {
+	return file_peril_v1_peril_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ArmyMove) GetPlayer() *Player {
+	if x != nil {
+		return x.Player
+	}
+	return nil
+}
+
+func (x *ArmyMove) GetUnits() []*Unit {
+	if x != nil {
+		return x.Units
+	}
+	return nil
+}
+
+func (x *ArmyMove) GetToLocation() string {
+	if x != nil {
+		return x.ToLocation
+	}
+	return ""
+}
+
+type RecognitionOfWar struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Attacker      *Player                `protobuf:"bytes,1,opt,name=attacker,proto3" json:"attacker,omitempty"`
+	Defender      *Player                `protobuf:"bytes,2,opt,name=defender,proto3" json:"defender,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RecognitionOfWar) Reset() {
+	*x = RecognitionOfWar{}
+	mi := &file_peril_v1_peril_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RecognitionOfWar) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RecognitionOfWar) ProtoMessage() {}
+
+func (x *RecognitionOfWar) ProtoReflect() protoreflect.Message {
+	mi := &file_peril_v1_peril_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RecognitionOfWar.ProtoReflect.Descriptor instead.
+func (*RecognitionOfWar) Descriptor() ([]byte, []int) {
+	return file_peril_v1_peril_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *RecognitionOfWar) GetAttacker() *Player {
+	if x != nil {
+		return x.Attacker
+	}
+	return nil
+}
+
+func (x *RecognitionOfWar) GetDefender() *Player {
+	if x != nil {
+		return x.Defender
+	}
+	return nil
+}
+
+type UnitIds struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ids           []int64                `protobuf:"varint,1,rep,packed,name=ids,proto3" json:"ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UnitIds) Reset() {
+	*x = UnitIds{}
+	mi := &file_peril_v1_peril_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UnitIds) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UnitIds) ProtoMessage() {}
+
+func (x *UnitIds) ProtoReflect() protoreflect.Message {
+	mi := &file_peril_v1_peril_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UnitIds.ProtoReflect.Descriptor instead.
+func (*UnitIds) Descriptor() ([]byte, []int) {
+	return file_peril_v1_peril_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *UnitIds) GetIds() []int64 {
+	if x != nil {
+		return x.Ids
+	}
+	return nil
+}
+
+type WarResolution struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Attacker string                 `protobuf:"bytes,1,opt,name=attacker,proto3" json:"attacker,omitempty"`
+	Defender string                 `protobuf:"bytes,2,opt,name=defender,proto3" json:"defender,omitempty"`
+	Location string                 `protobuf:"bytes,3,opt,name=location,proto3" json:"location,omitempty"`
+	// Winner and loser are empty on a draw.
+	Winner string `protobuf:"bytes,4,opt,name=winner,proto3" json:"winner,omitempty"`
+	Loser  string `protobuf:"bytes,5,opt,name=loser,proto3" json:"loser,omitempty"`
+	// Unit ids lost, keyed by username.
+	Killed        map[string]*UnitIds `protobuf:"bytes,6,rep,name=killed,proto3" json:"killed,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WarResolution) Reset() {
+	*x = WarResolution{}
+	mi := &file_peril_v1_peril_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WarResolution) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WarResolution) ProtoMessage() {}
+
+func (x *WarResolution) ProtoReflect() protoreflect.Message {
+	mi := &file_peril_v1_peril_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WarResolution.ProtoReflect.Descriptor instead.
+func (*WarResolution) Descriptor() ([]byte, []int) {
+	return file_peril_v1_peril_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *WarResolution) GetAttacker() string {
+	if x != nil {
+		return x.Attacker
+	}
+	return ""
+}
+
+func (x *WarResolution) GetDefender() string {
+	if x != nil {
+		return x.Defender
+	}
+	return ""
+}
+
+func (x *WarResolution) GetLocation() string {
+	if x != nil {
+		return x.Location
+	}
+	return ""
+}
+
+func (x *WarResolution) GetWinner() string {
+	if x != nil {
+		return x.Winner
+	}
+	return ""
+}
+
+func (x *WarResolution) GetLoser() string {
+	if x != nil {
+		return x.Loser
+	}
+	return ""
+}
+
+func (x *WarResolution) GetKilled() map[string]*UnitIds {
+	if x != nil {
+		return x.Killed
+	}
+	return nil
+}
+
+type UnitSpawned struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Username      string                 `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	Unit          *Unit                  `protobuf:"bytes,2,opt,name=unit,proto3" json:"unit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UnitSpawned) Reset() {
+	*x = UnitSpawned{}
+	mi := &file_peril_v1_peril_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UnitSpawned) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UnitSpawned) ProtoMessage() {}
+
+func (x *UnitSpawned) ProtoReflect() protoreflect.Message {
+	mi := &file_peril_v1_peril_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UnitSpawned.ProtoReflect.Descriptor instead.
+func (*UnitSpawned) Descriptor() ([]byte, []int) {
+	return file_peril_v1_peril_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *UnitSpawned) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *UnitSpawned) GetUnit() *Unit {
+	if x != nil {
+		return x.Unit
+	}
+	return nil
+}
+
+type Violation struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Username string                 `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	// "spawn" or "move".
+	Action        string        `protobuf:"bytes,2,opt,name=action,proto3" json:"action,omitempty"`
+	Kind          ViolationKind `protobuf:"varint,3,opt,name=kind,proto3,enum=peril.v1.ViolationKind" json:"kind,omitempty"`
+	Detail        string        `protobuf:"bytes,4,opt,name=detail,proto3" json:"detail,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Violation) Reset() {
+	*x = Violation{}
+	mi := &file_peril_v1_peril_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Violation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Violation) ProtoMessage() {}
+
+func (x *Violation) ProtoReflect() protoreflect.Message {
+	mi := &file_peril_v1_peril_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Violation.ProtoReflect.Descriptor instead.
+func (*Violation) Descriptor() ([]byte, []int) {
+	return file_peril_v1_peril_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Violation) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *Violation) GetAction() string {
+	if x != nil {
+		return x.Action
+	}
+	return ""
+}
+
+func (x *Violation) GetKind() ViolationKind {
+	if x != nil {
+		return x.Kind
+	}
+	return ViolationKind_VIOLATION_KIND_UNSPECIFIED
+}
+
+func (x *Violation) GetDetail() string {
+	if x != nil {
+		return x.Detail
+	}
+	return ""
+}
+
+var File_peril_v1_peril_proto protoreflect.FileDescriptor
+
+const file_peril_v1_peril_proto_rawDesc = "" +
+	"\n" +
+	"\x14peril/v1/peril.proto\x12\bperil.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"+\n" +
+	"\fPlayingState\x12\x1b\n" +
+	"\tis_paused\x18\x01 \x01(\bR\bisPaused\"\xa5\x01\n" +
+	"\aGameLog\x12=\n" +
+	"\fcurrent_time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\vcurrentTime\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12\x1a\n" +
+	"\busername\x18\x03 \x01(\tR\busername\x12%\n" +
+	"\x04kind\x18\x04 \x01(\x0e2\x11.peril.v1.LogKindR\x04kind\"Z\n" +
+	"\x04Unit\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12&\n" +
+	"\x04rank\x18\x02 \x01(\x0e2\x12.peril.v1.UnitRankR\x04rank\x12\x1a\n" +
+	"\blocation\x18\x03 \x01(\tR\blocation\"\xa1\x01\n" +
+	"\x06Player\x12\x1a\n" +
+	"\busername\x18\x01 \x01(\tR\busername\x121\n" +
+	"\x05units\x18\x02 \x03(\v2\x1b.peril.v1.Player.UnitsEntryR\x05units\x1aH\n" +
+	"\n" +
+	"UnitsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\x03R\x03key\x12$\n" +
+	"\x05value\x18\x02 \x01(\v2\x0e.peril.v1.UnitR\x05value:\x028\x01\"{\n" +
+	"\bArmyMove\x12(\n" +
+	"\x06player\x18\x01 \x01(\v2\x10.peril.v1.PlayerR\x06player\x12$\n" +
+	"\x05units\x18\x02 \x03(\v2\x0e.peril.v1.UnitR\x05units\x12\x1f\n" +
+	"\vto_location\x18\x03 \x01(\tR\n" +
+	"toLocation\"n\n" +
+	"\x10RecognitionOfWar\x12,\n" +
+	"\battacker\x18\x01 \x01(\v2\x10.peril.v1.PlayerR\battacker\x12,\n" +
+	"\bdefender\x18\x02 \x01(\v2\x10.peril.v1.PlayerR\bdefender\"\x1b\n" +
+	"\aUnitIds\x12\x10\n" +
+	"\x03ids\x18\x01 \x03(\x03R\x03ids\"\x9c\x02\n" +
+	"\rWarResolution\x12\x1a\n" +
+	"\battacker\x18\x01 \x01(\tR\battacker\x12\x1a\n" +
+	"\bdefender\x18\x02 \x01(\tR\bdefender\x12\x1a\n" +
+	"\blocation\x18\x03 \x01(\tR\blocation\x12\x16\n" +
+	"\x06winner\x18\x04 \x01(\tR\x06winner\x12\x14\n" +
+	"\x05loser\x18\x05 \x01(\tR\x05loser\x12;\n" +
+	"\x06killed\x18\x06 \x03(\v2#.peril.v1.WarResolution.KilledEntryR\x06killed\x1aL\n" +
+	"\vKilledEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12'\n" +
+	"\x05value\x18\x02 \x01(\v2\x11.peril.v1.UnitIdsR\x05value:\x028\x01\"M\n" +
+	"\vUnitSpawned\x12\x1a\n" +
+	"\busername\x18\x01 \x01(\tR\busername\x12\"\n" +
+	"\x04unit\x18\x02 \x01(\v2\x0e.peril.v1.UnitR\x04unit\"\x84\x01\n" +
+	"\tViolation\x12\x1a\n" +
+	"\busername\x18\x01 \x01(\tR\busername\x12\x16\n" +
+	"\x06action\x18\x02 \x01(\tR\x06action\x12+\n" +
+	"\x04kind\x18\x03 \x01(\x0e2\x17.peril.v1.ViolationKindR\x04kind\x12\x16\n" +
+	"\x06detail\x18\x04 \x01(\tR\x06detail*H\n" +
+	"\aLogKind\x12\x18\n" +
+	"\x14LOG_KIND_UNSPECIFIED\x10\x00\x12\x10\n" +
+	"\fLOG_KIND_WAR\x10\x01\x12\x11\n" +
+	"\rLOG_KIND_SPAM\x10\x02*m\n" +
+	"\bUnitRank\x12\x19\n" +
+	"\x15UNIT_RANK_UNSPECIFIED\x10\x00\x12\x16\n" +
+	"\x12UNIT_RANK_INFANTRY\x10\x01\x12\x15\n" +
+	"\x11UNIT_RANK_CAVALRY\x10\x02\x12\x17\n" +
+	"\x13UNIT_RANK_ARTILLERY\x10\x03*\x83\x02\n" +
+	"\rViolationKind\x12\x1e\n" +
+	"\x1aVIOLATION_KIND_UNSPECIFIED\x10\x00\x12!\n" +
+	"\x1dVIOLATION_KIND_UNKNOWN_PLAYER\x10\x01\x12\x1f\n" +
+	"\x1bVIOLATION_KIND_UNKNOWN_UNIT\x10\x02\x12\"\n" +
+	"\x1eVIOLATION_KIND_FABRICATED_UNIT\x10\x03\x12!\n" +
+	"\x1dVIOLATION_KIND_DUPLICATE_UNIT\x10\x04\x12&\n" +
+	"\"VIOLATION_KIND_IMPOSSIBLE_LOCATION\x10\x05\x12\x1f\n" +
+	"\x1bVIOLATION_KIND_INVALID_RANK\x10\x06B\x19Z\x17pubsub/internal/perilpbb\x06proto3"
+
+var (
+	file_peril_v1_peril_proto_rawDescOnce sync.Once
+	file_peril_v1_peril_proto_rawDescData []byte
+)
+
+func file_peril_v1_peril_proto_rawDescGZIP() []byte {
+	file_peril_v1_peril_proto_rawDescOnce.Do(func() {
+		file_peril_v1_peril_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_peril_v1_peril_proto_rawDesc), len(file_peril_v1_peril_proto_rawDesc)))
+	})
+	return file_peril_v1_peril_proto_rawDescData
+}
+
+var file_peril_v1_peril_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_peril_v1_peril_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_peril_v1_peril_proto_goTypes = []any{
+	(LogKind)(0),                  // 0: peril.v1.LogKind
+	(UnitRank)(0),                 // 1: peril.v1.UnitRank
+	(ViolationKind)(0),            // 2: peril.v1.ViolationKind
+	(*PlayingState)(nil),          // 3: peril.v1.PlayingState
+	(*GameLog)(nil),               // 4: peril.v1.GameLog
+	(*Unit)(nil),                  // 5: peril.v1.Unit
+	(*Player)(nil),                // 6: peril.v1.Player
+	(*ArmyMove)(nil),              // 7: peril.v1.ArmyMove
+	(*RecognitionOfWar)(nil),      // 8: peril.v1.RecognitionOfWar
+	(*UnitIds)(nil),               // 9: peril.v1.UnitIds
+	(*WarResolution)(nil),         // 10: peril.v1.WarResolution
+	(*UnitSpawned)(nil),           // 11: peril.v1.UnitSpawned
+	(*Violation)(nil),             // 12: peril.v1.Violation
+	nil,                           // 13: peril.v1.Player.UnitsEntry
+	nil,                           // 14: peril.v1.WarResolution.KilledEntry
+	(*timestamppb.Timestamp)(nil), // 15: google.protobuf.Timestamp
+}
+var file_peril_v1_peril_proto_depIdxs = []int32{
+	15, // 0: peril.v1.GameLog.current_time:type_name -> google.protobuf.Timestamp
+	0,  // 1: peril.v1.GameLog.kind:type_name -> peril.v1.LogKind
+	1,  // 2: peril.v1.Unit.rank:type_name -> peril.v1.UnitRank
+	13, // 3: peril.v1.Player.units:type_name -> peril.v1.Player.UnitsEntry
+	6,  // 4: peril.v1.ArmyMove.player:type_name -> peril.v1.Player
+	5,  // 5: peril.v1.ArmyMove.units:type_name -> peril.v1.Unit
+	6,  // 6: peril.v1.RecognitionOfWar.attacker:type_name -> peril.v1.Player
+	6,  // 7: peril.v1.RecognitionOfWar.defender:type_name -> peril.v1.Player
+	14, // 8: peril.v1.WarResolution.killed:type_name -> peril.v1.WarResolution.KilledEntry
+	5,  // 9: peril.v1.UnitSpawned.unit:type_name -> peril.v1.Unit
+	2,  // 10: peril.v1.Violation.kind:type_name -> peril.v1.ViolationKind
+	5,  // 11: peril.v1.Player.UnitsEntry.value:type_name -> peril.v1.Unit
+	9,  // 12: peril.v1.WarResolution.KilledEntry.value:type_name -> peril.v1.UnitIds
+	13, // [13:13] is the sub-list for method output_type
+	13, // [13:13] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
+}
+
+func init() { file_peril_v1_peril_proto_init() }
+func file_peril_v1_peril_proto_init() {
+	if File_peril_v1_peril_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_peril_v1_peril_proto_rawDesc), len(file_peril_v1_peril_proto_rawDesc)),
+			NumEnums:      3,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_peril_v1_peril_proto_goTypes,
+		DependencyIndexes: file_peril_v1_peril_proto_depIdxs,
+		EnumInfos:         file_peril_v1_peril_proto_enumTypes,
+		MessageInfos:      file_peril_v1_peril_proto_msgTypes,
+	}.Build()
+	File_peril_v1_peril_proto = out.File
+	file_peril_v1_peril_proto_goTypes = nil
+	file_peril_v1_peril_proto_depIdxs = nil
+}
@@ -0,0 +1,85 @@
+package pubsub
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Publisher is the publishing half of a channel. *amqp.Channel satisfies it.
+type Publisher interface {
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+}
+
+// Channel is the subset of *amqp.Channel used by this package, so that
+// *amqp.Channel satisfies it directly.
+type Channel interface {
+	Publisher
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	ExchangeDeclarePassive(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	QueueUnbind(name, key, exchange string, args amqp.Table) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Get(queue string, autoAck bool) (amqp.Delivery, bool, error)
+	QueuePurge(name string, noWait bool) (int, error)
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Cancel(consumer string, noWait bool) error
+	Confirm(noWait bool) error
+	NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation
+	NotifyReturn(c chan amqp.Return) chan amqp.Return
+	NotifyClose(c chan *amqp.Error) chan *amqp.Error
+	Close() error
+}
+
+// Broker hands out channels. It is implemented on top of a RabbitMQ
+// connection by AMQPBroker and in process by MemoryBroker.
+type Broker interface {
+	Channel() (Channel, error)
+	NotifyClose(c chan *amqp.Error) chan *amqp.Error
+	Close() error
+}
+
+type AMQPBroker struct {
+	*amqp.Connection
+}
+
+func NewAMQPBroker(conn *amqp.Connection) *AMQPBroker {
+	return &AMQPBroker{Connection: conn}
+}
+
+func DialAMQP(url string) (*AMQPBroker, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	return NewAMQPBroker(conn), nil
+}
+
+func (b *AMQPBroker) Channel() (Channel, error) {
+	ch, err := b.Connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+var consumerSeq atomic.Uint64
+
+func uniqueConsumerTag() string {
+	return fmt.Sprintf("%s-%d-%d", filepath.Base(os.Args[0]), os.Getpid(), consumerSeq.Add(1))
+}
+
+// newID returns a random identifier for correlating messages.
+func newID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,150 @@
+package pubsub
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	ContentTypeJSON    = "application/json"
+	ContentTypeGob     = "application/gob"
+	ContentTypeMsgPack = "application/msgpack"
+	ContentTypeCBOR    = "application/cbor"
+)
+
+// Codec turns values into message bodies of one content type and back.
+type Codec interface {
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// contentTypeOf lets a codec describe the encoded value more precisely
+// than its bare content type, for example with a message type parameter.
+func contentTypeOf(c Codec, v any) string {
+	if tc, ok := c.(interface{ ContentTypeOf(v any) string }); ok {
+		return tc.ContentTypeOf(v)
+	}
+	return c.ContentType()
+}
+
+var (
+	JSONCodec    Codec = jsonCodec{}
+	GobCodec     Codec = gobCodec{}
+	MsgPackCodec Codec = msgpackCodec{}
+	CBORCodec    Codec = cborCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string                { return ContentTypeJSON }
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+type gobCodec struct{}
+
+func (gobCodec) ContentType() string { return ContentTypeGob }
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string                { return ContentTypeMsgPack }
+func (msgpackCodec) Marshal(v any) ([]byte, error)      { return msgpack.Marshal(v) }
+func (msgpackCodec) Unmarshal(data []byte, v any) error { return msgpack.Unmarshal(data, v) }
+
+type cborCodec struct{}
+
+func (cborCodec) ContentType() string                { return ContentTypeCBOR }
+func (cborCodec) Marshal(v any) ([]byte, error)      { return cbor.Marshal(v) }
+func (cborCodec) Unmarshal(data []byte, v any) error { return cbor.Unmarshal(data, v) }
+
+// UnknownContentTypeError is returned for a message whose content type has
+// no registered codec.
+type UnknownContentTypeError struct {
+	ContentType string
+}
+
+func (e *UnknownContentTypeError) Error() string {
+	return fmt.Sprintf("no codec registered for content type %q", e.ContentType)
+}
+
+// CodecRegistry maps MIME types to codecs.
+type CodecRegistry struct {
+	mu     sync.RWMutex
+	codecs map[string]Codec
+}
+
+func NewCodecRegistry(codecs ...Codec) *CodecRegistry {
+	r := &CodecRegistry{codecs: map[string]Codec{}}
+	for _, c := range codecs {
+		r.Register(c)
+	}
+	return r
+}
+
+// Register adds c, replacing any codec for the same content type.
+func (r *CodecRegistry) Register(c Codec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.codecs[c.ContentType()] = c
+}
+
+// Lookup finds the codec for contentType, ignoring parameters such as
+// charset.
+func (r *CodecRegistry) Lookup(contentType string) (Codec, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.codecs[mediaType]
+	if !ok {
+		return nil, &UnknownContentTypeError{ContentType: contentType}
+	}
+	return c, nil
+}
+
+// Decode unmarshals data into a T with the codec for contentType.
+func Decode[T any](r *CodecRegistry, contentType string, data []byte) (T, error) {
+	var out T
+	c, err := r.Lookup(contentType)
+	if err != nil {
+		return out, err
+	}
+	if cu, ok := c.(contentTypeUnmarshaler); ok {
+		err = cu.UnmarshalContentType(contentType, data, &out)
+	} else {
+		err = c.Unmarshal(data, &out)
+	}
+	return out, err
+}
+
+// contentTypeUnmarshaler is implemented by codecs that need the content
+// type's parameters to decode, like ProtoCodec decoding into an interface.
+type contentTypeUnmarshaler interface {
+	UnmarshalContentType(contentType string, data []byte, v any) error
+}
+
+// DefaultCodecs is used by Subscribe unless WithCodecs says otherwise.
+var DefaultCodecs = NewCodecRegistry(JSONCodec, GobCodec, MsgPackCodec, CBORCodec)
+
+func RegisterCodec(c Codec) {
+	DefaultCodecs.Register(c)
+}
@@ -0,0 +1,81 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type testMove struct {
+	Player string
+	Units  []int
+}
+
+func TestDefaultCodecsRoundTrip(t *testing.T) {
+	want := testMove{Player: "alice", Units: []int{1, 2}}
+	for _, c := range []Codec{JSONCodec, GobCodec, MsgPackCodec, CBORCodec} {
+		data, err := c.Marshal(want)
+		if err != nil {
+			t.Fatalf("%s: %v", c.ContentType(), err)
+		}
+		got, err := Decode[testMove](DefaultCodecs, c.ContentType(), data)
+		if err != nil {
+			t.Fatalf("%s: %v", c.ContentType(), err)
+		}
+		if got.Player != want.Player || len(got.Units) != 2 || got.Units[1] != 2 {
+			t.Errorf("%s decoded %+v, want %+v", c.ContentType(), got, want)
+		}
+	}
+}
+
+func TestCodecRegistryLookup(t *testing.T) {
+	r := NewCodecRegistry(JSONCodec)
+	if c, err := r.Lookup("application/json; charset=utf-8"); err != nil || c != JSONCodec {
+		t.Errorf("lookup with parameters returned %v, %v", c, err)
+	}
+	_, err := r.Lookup(ContentTypeGob)
+	var unknown *UnknownContentTypeError
+	if !errors.As(err, &unknown) || unknown.ContentType != ContentTypeGob {
+		t.Errorf("lookup of an unregistered type returned %v", err)
+	}
+	r.Register(GobCodec)
+	if _, err := r.Lookup(ContentTypeGob); err != nil {
+		t.Errorf("registered codec was not found: %v", err)
+	}
+}
+
+// One subscription accepts every registered content type.
+func TestSubscribeDecodesByContentType(t *testing.T) {
+	b := NewMemoryBroker()
+	ch := newTestChannel(t, b)
+	CreateExchange(ch, "topic", Topic, Durable)
+
+	got := make(chan string, 2)
+	sub, err := Subscribe(b, "topic", "moves", "army_moves.*", Durable,
+		func(ctx context.Context, d *Delivery[testMove]) AckType {
+			got <- d.ContentType + " " + d.Body.Player
+			return Ack
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close(context.Background())
+
+	for _, c := range []Codec{MsgPackCodec, CBORCodec} {
+		if err := Publish(ch, c, "topic", "army_moves.alice", testMove{Player: "alice"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{ContentTypeMsgPack + " alice", ContentTypeCBOR + " alice"} {
+		select {
+		case body := <-got:
+			if body != want {
+				t.Errorf("got %q, want %q", body, want)
+			}
+		case <-time.After(testTimeout):
+			t.Fatalf("%q never arrived", want)
+		}
+	}
+}
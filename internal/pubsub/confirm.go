@@ -0,0 +1,208 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var ErrNacked = errors.New("message was nacked by the broker")
+
+// UnroutableError reports a mandatory message that no queue was bound to
+// receive.
+type UnroutableError struct {
+	Exchange  string
+	Key       string
+	ReplyCode uint16
+	ReplyText string
+}
+
+func (e *UnroutableError) Error() string {
+	return fmt.Sprintf("message to exchange %s with key %s was not routed: %d %s", e.Exchange, e.Key, e.ReplyCode, e.ReplyText)
+}
+
+// Confirmation is the pending outcome of a single publish.
+type Confirmation struct {
+	messageID string
+	done      chan struct{}
+	err       error
+	returned  *UnroutableError
+}
+
+func (c *Confirmation) Done() <-chan struct{} {
+	return c.done
+}
+
+// Wait blocks until the broker acked or nacked the message. It returns
+// nil on ack, an *UnroutableError if a mandatory message came back and
+// ErrNacked otherwise.
+func (c *Confirmation) Wait(ctx context.Context) error {
+	select {
+	case <-c.done:
+		return c.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ConfirmPublisher puts a channel in confirm mode and tracks the broker's
+// answer for every message it publishes. It satisfies Publisher, so
+// PublishJSON and PublishGob can be pointed at it to publish reliably.
+type ConfirmPublisher struct {
+	ch Channel
+	// Mandatory makes every publish mandatory, so unroutable messages
+	// fail with an *UnroutableError.
+	Mandatory bool
+
+	publishMu sync.Mutex
+
+	mu      sync.Mutex
+	seq     uint64
+	pending map[uint64]*Confirmation
+	closed  bool
+}
+
+func NewConfirmPublisher(ch Channel) (*ConfirmPublisher, error) {
+	if err := ch.Confirm(false); err != nil {
+		return nil, fmt.Errorf("Enabling publisher confirms failed: %w", err)
+	}
+	p := &ConfirmPublisher{
+		ch:      ch,
+		pending: map[uint64]*Confirmation{},
+	}
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, 64))
+	returns := ch.NotifyReturn(make(chan amqp.Return, 64))
+	go p.listen(confirms, returns)
+	return p, nil
+}
+
+// PublishDeferred publishes msg and returns a Confirmation without waiting
+// for the broker. Returned messages are matched with their publish by
+// MessageId, so one is generated if msg has none.
+func (p *ConfirmPublisher) PublishDeferred(ctx context.Context, exchange, key string, mandatory bool, msg amqp.Publishing) (*Confirmation, error) {
+	p.publishMu.Lock()
+	defer p.publishMu.Unlock()
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, amqp.ErrClosed
+	}
+	if msg.MessageId == "" {
+		msg.MessageId = newID()
+	}
+	seq := p.seq + 1
+	conf := &Confirmation{messageID: msg.MessageId, done: make(chan struct{})}
+	p.pending[seq] = conf
+	p.mu.Unlock()
+
+	err := p.ch.PublishWithContext(ctx, exchange, key, mandatory || p.Mandatory, false, msg)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		delete(p.pending, seq)
+		return nil, err
+	}
+	p.seq = seq
+	return conf, nil
+}
+
+func (p *ConfirmPublisher) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	conf, err := p.PublishDeferred(ctx, exchange, key, mandatory, msg)
+	if err != nil {
+		return err
+	}
+	return conf.Wait(ctx)
+}
+
+// Close stops tracking confirmations and closes the underlying channel.
+func (p *ConfirmPublisher) Close() error {
+	return p.ch.Close()
+}
+
+func (p *ConfirmPublisher) listen(confirms chan amqp.Confirmation, returns chan amqp.Return) {
+	for {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			p.markReturned(r)
+		case c, ok := <-confirms:
+			if !ok {
+				p.failPending(amqp.ErrClosed)
+				return
+			}
+			// The broker sends basic.return before the ack of the same
+			// message, so any return for it is already buffered.
+			for drained := false; !drained && returns != nil; {
+				select {
+				case r, ok := <-returns:
+					if !ok {
+						returns = nil
+						continue
+					}
+					p.markReturned(r)
+				default:
+					drained = true
+				}
+			}
+			p.resolve(c)
+		}
+	}
+}
+
+// markReturned attributes r to the oldest pending publish with the same
+// MessageId. Returns arrive in publish order, so that is the right one
+// even when a message is republished under its original ID.
+func (p *ConfirmPublisher) markReturned(r amqp.Return) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var oldest uint64
+	for seq, conf := range p.pending {
+		if conf.messageID == r.MessageId && conf.returned == nil && (oldest == 0 || seq < oldest) {
+			oldest = seq
+		}
+	}
+	if conf, ok := p.pending[oldest]; ok {
+		conf.returned = &UnroutableError{
+			Exchange:  r.Exchange,
+			Key:       r.RoutingKey,
+			ReplyCode: r.ReplyCode,
+			ReplyText: r.ReplyText,
+		}
+	}
+}
+
+func (p *ConfirmPublisher) resolve(c amqp.Confirmation) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conf, ok := p.pending[c.DeliveryTag]
+	if !ok {
+		return
+	}
+	delete(p.pending, c.DeliveryTag)
+	switch {
+	case !c.Ack:
+		conf.err = ErrNacked
+	case conf.returned != nil:
+		conf.err = conf.returned
+	}
+	close(conf.done)
+}
+
+func (p *ConfirmPublisher) failPending(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for seq, conf := range p.pending {
+		conf.err = err
+		close(conf.done)
+		delete(p.pending, seq)
+	}
+}
@@ -0,0 +1,83 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func newTestPublisher(t *testing.T, ch Channel) *ConfirmPublisher {
+	t.Helper()
+	CreateExchange(ch, "direct", Direct, Durable)
+	declareQueue(t, ch, "pause", nil, [2]string{"direct", "pause"})
+	p, err := NewConfirmPublisher(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestConfirmPublisherConfirmsAndReturns(t *testing.T) {
+	ch := newTestChannel(t, NewMemoryBroker())
+	p := newTestPublisher(t, ch)
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	if err := p.PublishWithContext(ctx, "direct", "pause", true, false, amqp.Publishing{}); err != nil {
+		t.Errorf("routed publish failed: %v", err)
+	}
+	err := p.PublishWithContext(ctx, "direct", "nowhere", true, false, amqp.Publishing{})
+	var unroutable *UnroutableError
+	if !errors.As(err, &unroutable) || unroutable.Key != "nowhere" {
+		t.Errorf("unroutable publish returned %v, want an *UnroutableError", err)
+	}
+}
+
+func TestConfirmPublisherLeavesHeadersAlone(t *testing.T) {
+	ch := newTestChannel(t, NewMemoryBroker())
+	p := newTestPublisher(t, ch)
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	err := p.PublishWithContext(ctx, "direct", "pause", true, false, amqp.Publishing{MessageId: "m1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, ok, err := ch.Get("pause", true)
+	if err != nil || !ok {
+		t.Fatalf("message was not delivered: %v", err)
+	}
+	if len(d.Headers) != 0 {
+		t.Errorf("consumer saw headers %v, want none", d.Headers)
+	}
+	if d.MessageId != "m1" {
+		t.Errorf("message ID = %q, want m1", d.MessageId)
+	}
+}
+
+// A message republished under its ID is only failed if it came back.
+func TestConfirmPublisherReturnsByMessageID(t *testing.T) {
+	ch := newTestChannel(t, NewMemoryBroker())
+	p := newTestPublisher(t, ch)
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	msg := amqp.Publishing{MessageId: "m1"}
+	returned, err := p.PublishDeferred(ctx, "direct", "nowhere", true, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routed, err := p.PublishDeferred(ctx, "direct", "pause", true, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var unroutable *UnroutableError
+	if err := returned.Wait(ctx); !errors.As(err, &unroutable) {
+		t.Errorf("unroutable publish returned %v, want an *UnroutableError", err)
+	}
+	if err := routed.Wait(ctx); err != nil {
+		t.Errorf("routed publish with the same ID failed: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package pubsub
+
+import (
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// The retrier republishes messages through the default exchange, so the
+// route they were first published with is kept in these headers.
+const (
+	OriginalExchangeHeader   = "x-original-exchange"
+	OriginalRoutingKeyHeader = "x-original-routing-key"
+)
+
+// DeathRecord is one entry of the x-death header RabbitMQ maintains for
+// dead-lettered messages, most recent first.
+type DeathRecord struct {
+	Queue       string
+	Reason      string
+	Exchange    string
+	RoutingKeys []string
+	Count       int64
+	Time        time.Time
+}
+
+func Deaths(headers amqp.Table) []DeathRecord {
+	entries, _ := headers["x-death"].([]any)
+	deaths := []DeathRecord{}
+	for _, e := range entries {
+		t, ok := e.(amqp.Table)
+		if !ok {
+			continue
+		}
+		d := DeathRecord{}
+		d.Queue, _ = t["queue"].(string)
+		d.Reason, _ = t["reason"].(string)
+		d.Exchange, _ = t["exchange"].(string)
+		d.Count, _ = tableInt(t["count"])
+		d.Time, _ = t["time"].(time.Time)
+		keys, _ := t["routing-keys"].([]any)
+		for _, k := range keys {
+			if key, ok := k.(string); ok {
+				d.RoutingKeys = append(d.RoutingKeys, key)
+			}
+		}
+		deaths = append(deaths, d)
+	}
+	return deaths
+}
+
+// OriginalRoute returns the exchange and routing key a dead-lettered
+// message was originally published with.
+func OriginalRoute(msg amqp.Delivery) (exchange, key string) {
+	if ex, ok := msg.Headers[OriginalExchangeHeader].(string); ok {
+		key, _ = msg.Headers[OriginalRoutingKeyHeader].(string)
+		return ex, key
+	}
+	deaths := Deaths(msg.Headers)
+	if len(deaths) == 0 {
+		return msg.Exchange, msg.RoutingKey
+	}
+	first := deaths[len(deaths)-1]
+	if len(first.RoutingKeys) > 0 {
+		key = first.RoutingKeys[0]
+	}
+	return first.Exchange, key
+}
+
+// ReplayPublishing turns a dead-lettered delivery back into a publishing
+// with its delivery history cleared, so that it gets a fresh set of
+// retries instead of being parked as poison straight away.
+func ReplayPublishing(msg amqp.Delivery) amqp.Publishing {
+	publishing := publishingFromDelivery(msg)
+	headers := copyTable(msg.Headers)
+	for _, h := range []string{
+		"x-death",
+		"x-first-death-queue",
+		"x-first-death-reason",
+		"x-first-death-exchange",
+		"x-delivery-count",
+		retryCountHeader,
+		OriginalExchangeHeader,
+		OriginalRoutingKeyHeader,
+	} {
+		delete(headers, h)
+	}
+	publishing.Headers = headers
+	return publishing
+}
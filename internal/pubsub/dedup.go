@@ -0,0 +1,275 @@
+package pubsub
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DedupStore remembers which messages have been handled.
+type DedupStore interface {
+	Seen(key string) (bool, error)
+	Mark(key string) error
+}
+
+// KeyFunc picks the idempotency key of a message. An empty key disables
+// deduplication for that message.
+type KeyFunc func(m *Message) string
+
+// MessageIDKey keys messages on their envelope message ID.
+func MessageIDKey(m *Message) string {
+	return m.Envelope.MessageID
+}
+
+// Idempotent acks messages whose key is already in store without running
+// the handler. A key is recorded once the handler acks its message, so
+// failed, retried and dead-lettered messages run again when they come
+// back. A nil key uses MessageIDKey.
+func Idempotent(store DedupStore, key KeyFunc) Middleware {
+	if key == nil {
+		key = MessageIDKey
+	}
+	var mu sync.Mutex
+	inflight := map[string]chan struct{}{}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, m *Message) AckType {
+			k := key(m)
+			if k == "" {
+				return next(ctx, m)
+			}
+			// Concurrent duplicates wait for the first one to finish.
+			for {
+				mu.Lock()
+				wait, busy := inflight[k]
+				if !busy {
+					inflight[k] = make(chan struct{})
+					mu.Unlock()
+					break
+				}
+				mu.Unlock()
+				select {
+				case <-wait:
+				case <-ctx.Done():
+					return NackRequeue
+				}
+			}
+			defer func() {
+				mu.Lock()
+				close(inflight[k])
+				delete(inflight, k)
+				mu.Unlock()
+			}()
+
+			seen, err := store.Seen(k)
+			if err != nil {
+				m.Err = fmt.Errorf("checking dedup store: %w", err)
+				return NackRequeue
+			}
+			if seen {
+				return Ack
+			}
+			ack := next(ctx, m)
+			if ack == Ack {
+				if err := store.Mark(k); err != nil {
+					m.Err = fmt.Errorf("recording message as handled: %w", err)
+				}
+			}
+			return ack
+		}
+	}
+}
+
+type dedupEntry struct {
+	key     string
+	expires time.Time
+}
+
+// MemoryDedupStore keeps the most recent keys in memory, evicting the
+// least recently marked one when full and forgetting keys after their TTL.
+type MemoryDedupStore struct {
+	capacity int
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func NewMemoryDedupStore(capacity int, ttl time.Duration) *MemoryDedupStore {
+	return &MemoryDedupStore{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+func (s *MemoryDedupStore) Seen(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.entries[key]
+	if !ok {
+		return false, nil
+	}
+	if time.Now().After(el.Value.(*dedupEntry).expires) {
+		s.order.Remove(el)
+		delete(s.entries, key)
+		return false, nil
+	}
+	return true, nil
+}
+
+func (s *MemoryDedupStore) Mark(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires := time.Now().Add(s.ttl)
+	if el, ok := s.entries[key]; ok {
+		el.Value.(*dedupEntry).expires = expires
+		s.order.MoveToFront(el)
+		return nil
+	}
+	s.entries[key] = s.order.PushFront(&dedupEntry{key: key, expires: expires})
+	for s.capacity > 0 && s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*dedupEntry).key)
+	}
+	return nil
+}
+
+// FileDedupStore persists keys in an append-only file so that they
+// survive restarts. The file is rewritten without expired keys when it
+// has grown to twice the number of live ones.
+type FileDedupStore struct {
+	path string
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	f       *os.File
+	expires map[string]time.Time
+	lines   int
+}
+
+func NewFileDedupStore(path string, ttl time.Duration) (*FileDedupStore, error) {
+	s := &FileDedupStore{path: path, ttl: ttl, expires: map[string]time.Time{}}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Opening dedup store failed: %w", err)
+	}
+	s.f = f
+	return s, nil
+}
+
+// Each line is "<expiry unix nanos> <key>".
+func (s *FileDedupStore) load() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Opening dedup store failed: %w", err)
+	}
+	defer f.Close()
+	now := time.Now()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		s.lines++
+		stamp, key, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		nanos, err := strconv.ParseInt(stamp, 10, 64)
+		if err != nil {
+			continue
+		}
+		if expires := time.Unix(0, nanos); expires.After(now) {
+			s.expires[key] = expires
+		}
+	}
+	return scanner.Err()
+}
+
+func (s *FileDedupStore) Seen(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires, ok := s.expires[key]
+	if !ok {
+		return false, nil
+	}
+	if time.Now().After(expires) {
+		delete(s.expires, key)
+		return false, nil
+	}
+	return true, nil
+}
+
+func (s *FileDedupStore) Mark(key string) error {
+	if strings.ContainsAny(key, "\n") {
+		return fmt.Errorf("dedup key %q contains a newline", key)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires := time.Now().Add(s.ttl)
+	if _, err := fmt.Fprintf(s.f, "%d %s\n", expires.UnixNano(), key); err != nil {
+		return err
+	}
+	if err := s.f.Sync(); err != nil {
+		return err
+	}
+	s.expires[key] = expires
+	s.lines++
+	if s.lines > 2*len(s.expires)+1024 {
+		return s.compact()
+	}
+	return nil
+}
+
+// compact rewrites the file with only the live keys. The lock must be
+// held.
+func (s *FileDedupStore) compact() error {
+	now := time.Now()
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for key, expires := range s.expires {
+		if !expires.After(now) {
+			delete(s.expires, key)
+			continue
+		}
+		fmt.Fprintf(w, "%d %s\n", expires.UnixNano(), key)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	f.Close()
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.f.Close()
+	s.f, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0644)
+	s.lines = len(s.expires)
+	return err
+}
+
+func (s *FileDedupStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
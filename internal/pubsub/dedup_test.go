@@ -0,0 +1,78 @@
+package pubsub
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryDedupStoreExpiresAndEvicts(t *testing.T) {
+	s := NewMemoryDedupStore(2, 30*time.Millisecond)
+	s.Mark("a")
+	s.Mark("b")
+	s.Mark("c")
+	if seen, _ := s.Seen("a"); seen {
+		t.Error("oldest key survived past capacity")
+	}
+	if seen, _ := s.Seen("c"); !seen {
+		t.Error("newest key was forgotten")
+	}
+	time.Sleep(40 * time.Millisecond)
+	if seen, _ := s.Seen("c"); seen {
+		t.Error("key outlived its TTL")
+	}
+}
+
+func TestFileDedupStoreReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "handled.dedup")
+	s, err := NewFileDedupStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Mark("kept"); err != nil {
+		t.Fatal(err)
+	}
+	s.ttl = 10 * time.Millisecond
+	if err := s.Mark("expiring"); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	time.Sleep(20 * time.Millisecond)
+
+	s, err = NewFileDedupStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if seen, _ := s.Seen("kept"); !seen {
+		t.Error("key was lost across a restart")
+	}
+	if seen, _ := s.Seen("expiring"); seen {
+		t.Error("expired key was reloaded")
+	}
+	if _, ok := s.expires["expiring"]; ok {
+		t.Error("expired key is still held in memory")
+	}
+}
+
+func TestIdempotentSkipsHandledMessages(t *testing.T) {
+	runs := 0
+	outcome := NackRequeue
+	h := chain(func(ctx context.Context, m *Message) AckType {
+		runs++
+		return outcome
+	}, Idempotent(NewMemoryDedupStore(0, time.Hour), nil))
+	m := func() *Message { return &Message{Envelope: Envelope{MessageID: "m1"}} }
+
+	// A failed attempt is not recorded, so the redelivery runs again.
+	h(context.Background(), m())
+	outcome = Ack
+	h(context.Background(), m())
+	if ack := h(context.Background(), m()); ack != Ack {
+		t.Errorf("duplicate settled as %v, want Ack", ack)
+	}
+	if runs != 2 {
+		t.Errorf("handler ran %d times, want 2", runs)
+	}
+}
@@ -0,0 +1,69 @@
+package pubsub
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Handler processes one decoded message and decides how it is settled.
+type Handler[T any] func(ctx context.Context, d *Delivery[T]) AckType
+
+// Delivery is a decoded message together with its AMQP metadata. It
+// satisfies Publisher, so handlers can publish follow-up messages or
+// replies with PublishJSON and PublishGob.
+type Delivery[T any] struct {
+	Body        T
+	Headers     amqp.Table
+	ContentType string
+	Exchange    string
+	RoutingKey  string
+	Redelivered bool
+	Envelope    Envelope
+	// ReplyTo is set on RPC requests.
+	ReplyTo string
+
+	publisher Publisher
+	err       error
+}
+
+func newDelivery[T any](msg amqp.Delivery, body T, publisher Publisher) *Delivery[T] {
+	return &Delivery[T]{
+		Body:        body,
+		Headers:     msg.Headers,
+		ContentType: msg.ContentType,
+		Exchange:    msg.Exchange,
+		RoutingKey:  msg.RoutingKey,
+		Redelivered: msg.Redelivered,
+		Envelope:    EnvelopeOf(msg),
+		ReplyTo:     msg.ReplyTo,
+		publisher:   publisher,
+	}
+}
+
+// PublishWithContext publishes msg as a consequence of this delivery: a
+// message that names no cause of its own joins the delivery's correlation.
+func (d *Delivery[T]) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	_, caused := msg.Headers[CausationIDHeader]
+	if !caused && msg.MessageId != "" && d.Envelope.MessageID != "" {
+		var env Envelope
+		env.causedBy(d.Envelope)
+		msg.CorrelationId = env.CorrelationID
+		msg.Headers = copyTable(msg.Headers)
+		if msg.Headers == nil {
+			msg.Headers = amqp.Table{}
+		}
+		msg.Headers[CausationIDHeader] = env.CausationID
+	}
+	return d.publisher.PublishWithContext(ctx, exchange, key, mandatory, immediate, msg)
+}
+
+// SetError records why the handler failed. The error travels with the
+// message in the x-last-error header when it is retried or parked.
+func (d *Delivery[T]) SetError(err error) {
+	d.err = err
+}
+
+func (d *Delivery[T]) Err() error {
+	return d.err
+}
@@ -0,0 +1,40 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type recordingPublisher struct {
+	published []amqp.Publishing
+}
+
+func (p *recordingPublisher) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	p.published = append(p.published, msg)
+	return nil
+}
+
+func TestDeliveryPublishJoinsCorrelation(t *testing.T) {
+	pub := &recordingPublisher{}
+	d := newDelivery(amqp.Delivery{MessageId: "parent"}, "log", pub)
+
+	// A message built by hand may come without any headers.
+	if err := d.PublishWithContext(context.Background(), "", "q", false, false, amqp.Publishing{MessageId: "child"}); err != nil {
+		t.Fatal(err)
+	}
+	own := amqp.Publishing{MessageId: "other", CorrelationId: "mine", Headers: amqp.Table{CausationIDHeader: "elsewhere"}}
+	if err := d.PublishWithContext(context.Background(), "", "q", false, false, own); err != nil {
+		t.Fatal(err)
+	}
+
+	child := pub.published[0]
+	if child.CorrelationId != "parent" || child.Headers[CausationIDHeader] != "parent" {
+		t.Errorf("child has correlation %q and causation %v, want both parent", child.CorrelationId, child.Headers[CausationIDHeader])
+	}
+	other := pub.published[1]
+	if other.CorrelationId != "mine" || other.Headers[CausationIDHeader] != "elsewhere" {
+		t.Errorf("message with its own cause was rewritten: %q, %v", other.CorrelationId, other.Headers)
+	}
+}
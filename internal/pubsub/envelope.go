@@ -0,0 +1,145 @@
+package pubsub
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	SchemaVersionHeader = "x-schema-version"
+	CausationIDHeader   = "x-causation-id"
+)
+
+// Producer identifies this process in the AppId of everything it
+// publishes. Set it once at startup.
+var Producer = filepath.Base(os.Args[0])
+
+// Envelope is the metadata stamped on every message published through
+// Publish. Messages of one game action share a CorrelationID, and each
+// message's CausationID is the MessageID of the message it reacted to.
+type Envelope struct {
+	MessageID     string
+	Timestamp     time.Time
+	Type          string
+	Producer      string
+	SchemaVersion int
+	CorrelationID string
+	CausationID   string
+}
+
+// MessageTyper overrides the type name derived from the Go type.
+type MessageTyper interface {
+	MessageType() string
+}
+
+// SchemaVersioner reports the schema version of a message type. Types
+// that do not implement it are version 1.
+type SchemaVersioner interface {
+	SchemaVersion() int
+}
+
+// TypeName returns the envelope type of v, such as "routing.GameLog".
+func TypeName(v any) string {
+	if t, ok := v.(MessageTyper); ok {
+		return t.MessageType()
+	}
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil {
+		return ""
+	}
+	if t.PkgPath() == "" {
+		return t.String()
+	}
+	return filepath.Base(t.PkgPath()) + "." + t.Name()
+}
+
+func schemaVersion(v any) int {
+	if sv, ok := v.(SchemaVersioner); ok {
+		return sv.SchemaVersion()
+	}
+	return 1
+}
+
+type envelopeKey struct{}
+
+// ContextWithEnvelope makes env the cause of messages published with ctx.
+func ContextWithEnvelope(ctx context.Context, env Envelope) context.Context {
+	return context.WithValue(ctx, envelopeKey{}, env)
+}
+
+// EnvelopeFromContext returns the envelope of the message being handled.
+func EnvelopeFromContext(ctx context.Context) (Envelope, bool) {
+	env, ok := ctx.Value(envelopeKey{}).(Envelope)
+	return env, ok
+}
+
+// NewEnvelope creates the envelope for publishing v. If ctx carries the
+// envelope of a message being handled, the new message joins its
+// correlation and names it as the cause.
+func NewEnvelope(ctx context.Context, v any) Envelope {
+	env := Envelope{
+		MessageID:     newID(),
+		Timestamp:     time.Now().UTC(),
+		Type:          TypeName(v),
+		Producer:      Producer,
+		SchemaVersion: schemaVersion(v),
+	}
+	env.CorrelationID = env.MessageID
+	if parent, ok := EnvelopeFromContext(ctx); ok {
+		env.causedBy(parent)
+	}
+	return env
+}
+
+func (env *Envelope) causedBy(parent Envelope) {
+	env.CorrelationID = parent.CorrelationID
+	if env.CorrelationID == "" {
+		env.CorrelationID = parent.MessageID
+	}
+	env.CausationID = parent.MessageID
+}
+
+// Apply writes env into the message properties and headers.
+func (env Envelope) Apply(msg *amqp.Publishing) {
+	msg.MessageId = env.MessageID
+	msg.Timestamp = env.Timestamp
+	msg.Type = env.Type
+	msg.AppId = env.Producer
+	msg.CorrelationId = env.CorrelationID
+	msg.Headers = copyTable(msg.Headers)
+	if msg.Headers == nil {
+		msg.Headers = amqp.Table{}
+	}
+	msg.Headers[SchemaVersionHeader] = int64(env.SchemaVersion)
+	if env.CausationID != "" {
+		msg.Headers[CausationIDHeader] = env.CausationID
+	} else {
+		delete(msg.Headers, CausationIDHeader)
+	}
+}
+
+// EnvelopeOf reads the envelope of a delivery. Messages from producers
+// that do not stamp envelopes come back with empty fields and version 1.
+func EnvelopeOf(msg amqp.Delivery) Envelope {
+	env := Envelope{
+		MessageID:     msg.MessageId,
+		Timestamp:     msg.Timestamp,
+		Type:          msg.Type,
+		Producer:      msg.AppId,
+		SchemaVersion: 1,
+		CorrelationID: msg.CorrelationId,
+	}
+	if v, ok := tableInt(msg.Headers[SchemaVersionHeader]); ok {
+		env.SchemaVersion = int(v)
+	}
+	env.CausationID, _ = msg.Headers[CausationIDHeader].(string)
+	return env
+}
@@ -0,0 +1,155 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"strings"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// MatchMode is the x-match argument of a headers exchange binding.
+type MatchMode string
+
+const (
+	// MatchAll requires every bound header to be present with its value.
+	MatchAll MatchMode = "all"
+	// MatchAny requires at least one bound header to match.
+	MatchAny MatchMode = "any"
+	// The -with-x variants also compare headers starting with "x-",
+	// which the plain modes ignore.
+	MatchAllWithX MatchMode = "all-with-x"
+	MatchAnyWithX MatchMode = "any-with-x"
+)
+
+const xMatchArg = "x-match"
+
+// HeaderMatch selects messages on a headers exchange by their header
+// values instead of a routing key. A nil value matches any message that
+// carries the header at all.
+type HeaderMatch struct {
+	Mode   MatchMode
+	Values map[string]any
+}
+
+// MatchAllOf matches messages carrying every header in values.
+func MatchAllOf(values ...map[string]any) HeaderMatch {
+	return HeaderMatch{Mode: MatchAll, Values: mergeValues(values)}
+}
+
+// MatchAnyOf matches messages carrying at least one header in values.
+func MatchAnyOf(values ...map[string]any) HeaderMatch {
+	return HeaderMatch{Mode: MatchAny, Values: mergeValues(values)}
+}
+
+func mergeValues(values []map[string]any) map[string]any {
+	merged := map[string]any{}
+	for _, v := range values {
+		maps.Copy(merged, v)
+	}
+	return merged
+}
+
+// BindArgs returns the binding arguments RabbitMQ expects.
+func (m HeaderMatch) BindArgs() amqp.Table {
+	args := amqp.Table{}
+	for k, v := range m.Values {
+		args[k] = headerValue(v)
+	}
+	mode := m.Mode
+	if mode == "" {
+		mode = MatchAll
+	}
+	args[xMatchArg] = string(mode)
+	return args
+}
+
+// Matches reports whether a message with headers would be routed by m.
+func (m HeaderMatch) Matches(headers amqp.Table) bool {
+	return headersMatch(m.BindArgs(), headers)
+}
+
+// headerValue converts named types such as gamelogic.Location to the
+// basic types an amqp.Table accepts.
+func headerValue(v any) any {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return int64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	}
+	return v
+}
+
+// headersMatch implements the headers exchange: args are the binding
+// arguments including x-match.
+func headersMatch(args, headers amqp.Table) bool {
+	mode, _ := args[xMatchArg].(string)
+	if mode == "" {
+		mode = string(MatchAll)
+	}
+	withX := strings.HasSuffix(mode, "-with-x")
+	matchAny := strings.HasPrefix(mode, string(MatchAny))
+	for k, want := range args {
+		if k == xMatchArg || (!withX && strings.HasPrefix(k, "x-")) {
+			continue
+		}
+		got, present := headers[k]
+		ok := present && (want == nil || headerEqual(want, got))
+		if matchAny && ok {
+			return true
+		}
+		if !matchAny && !ok {
+			return false
+		}
+	}
+	return !matchAny
+}
+
+// headerEqual compares header values the way RabbitMQ does, ignoring the
+// width of integer types. Arrays and tables are compared deeply, as they
+// are not comparable with ==.
+func headerEqual(a, b any) bool {
+	if x, ok := tableInt(a); ok {
+		y, ok := tableInt(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// PublishHeaders publishes val to a headers exchange with the given
+// headers next to the envelope ones.
+func PublishHeaders[T any](ctx context.Context, ch Publisher, codec Codec, exchange string, headers map[string]any, val T) error {
+	body, err := codec.Marshal(val)
+	if err != nil {
+		return fmt.Errorf("Encoding %s failed: %w", codec.ContentType(), err)
+	}
+	msg := amqp.Publishing{ContentType: contentTypeOf(codec, val), Body: body, Headers: amqp.Table{}}
+	for k, v := range headers {
+		msg.Headers[k] = headerValue(v)
+	}
+	NewEnvelope(ctx, val).Apply(&msg)
+	return ch.PublishWithContext(ctx, exchange, "", false, false, msg)
+}
+
+// WithHeaderMatch binds the subscription's queue with match instead of a
+// routing key. The exchange must be a headers exchange.
+func WithHeaderMatch(match HeaderMatch) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.bindArgs = match.BindArgs()
+	}
+}
+
+// SubscribeHeaders is Subscribe on a headers exchange.
+func SubscribeHeaders[T any](b Broker, exchange, queueName string, match HeaderMatch, simpleQueueType int, handler Handler[T], opts ...SubscribeOption) (*Subscription, error) {
+	return Subscribe(b, exchange, queueName, "", simpleQueueType, handler, append(opts, WithHeaderMatch(match))...)
+}
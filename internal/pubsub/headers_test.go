@@ -0,0 +1,42 @@
+package pubsub
+
+import (
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestHeadersMatch(t *testing.T) {
+	headers := amqp.Table{
+		"player":   "alice",
+		"units":    int32(3),
+		"path":     []any{"europe", "asia"},
+		"meta":     amqp.Table{"rank": "general"},
+		"x-region": "europe",
+	}
+	tests := []struct {
+		name  string
+		match HeaderMatch
+		want  bool
+	}{
+		{"all present", MatchAllOf(map[string]any{"player": "alice", "units": 3}), true},
+		{"all with one wrong", MatchAllOf(map[string]any{"player": "alice", "units": 4}), false},
+		{"all with one missing", MatchAllOf(map[string]any{"player": "alice", "war": true}), false},
+		{"any with one wrong", MatchAnyOf(map[string]any{"player": "bob", "units": int64(3)}), true},
+		{"any with none", MatchAnyOf(map[string]any{"player": "bob", "units": 4}), false},
+		{"presence only", MatchAllOf(map[string]any{"player": nil}), true},
+		{"array", MatchAllOf(map[string]any{"path": []any{"europe", "asia"}}), true},
+		{"different array", MatchAllOf(map[string]any{"path": []any{"asia"}}), false},
+		{"table", MatchAnyOf(map[string]any{"meta": amqp.Table{"rank": "general"}}), true},
+		{"table against string", MatchAnyOf(map[string]any{"meta": "general"}), false},
+		{"x- header ignored", MatchAllOf(map[string]any{"player": "alice", "x-region": "asia"}), true},
+		{"x- header with x", HeaderMatch{Mode: MatchAllWithX, Values: map[string]any{"player": "alice", "x-region": "asia"}}, false},
+		{"any with x", HeaderMatch{Mode: MatchAnyWithX, Values: map[string]any{"x-region": "europe"}}, true},
+		{"any without x", HeaderMatch{Mode: MatchAny, Values: map[string]any{"x-region": "europe"}}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.match.Matches(headers); got != tt.want {
+			t.Errorf("%s: Matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -30,13 +30,16 @@ const (
 	Ack         AckType = "ack"
 	NackRequeue AckType = "nackrequeue"
 	NackDiscard AckType = "nackdiscard"
+	// Retry parks the message in a delay queue according to the
+	// subscription's RetryPolicy instead of requeueing it immediately.
+	Retry AckType = "retry"
 )
 
 func GetDeadLetterConfig() amqp.Table {
 	return amqp.Table{"x-dead-letter-exchange": routing.ExchangePerilDlx}
 }
 
-func CreateExchange(ch *amqp.Channel, name, exchangeType string, exchangeParam int) error {
+func CreateExchange(ch Channel, name, exchangeType string, exchangeParam int) error {
 	err := ch.ExchangeDeclare(name, exchangeType, exchangeParam == Durable, exchangeParam == Transient, false, false, nil)
 	if err != nil {
 		return err
@@ -44,41 +47,40 @@ func CreateExchange(ch *amqp.Channel, name, exchangeType string, exchangeParam i
 	return nil
 }
 
-func PublishJSON[T any](ch *amqp.Channel, exchange, key string, val T) error {
-	packet, err := json.Marshal(val)
+// Publish encodes val with codec and publishes it with the codec's
+// content type, so that Subscribe can pick the matching decoder.
+func Publish[T any](ch Publisher, codec Codec, exchange, key string, val T) error {
+	return PublishContext(context.Background(), ch, codec, exchange, key, val)
+}
+
+// PublishContext is Publish with a context. If ctx is a handler's context
+// the message is stamped as caused by the message being handled.
+func PublishContext[T any](ctx context.Context, ch Publisher, codec Codec, exchange, key string, val T) error {
+	body, err := codec.Marshal(val)
 	if err != nil {
-		panic("Marshalling failed")
-	}
-	err = ch.PublishWithContext(
-		context.Background(),
-		exchange,
-		key,
-		false, false,
-		amqp.Publishing{ContentType: "application/json", Body: packet},
-	)
-	return err
+		return fmt.Errorf("Encoding %s failed: %w", codec.ContentType(), err)
+	}
+	msg := amqp.Publishing{ContentType: contentTypeOf(codec, val), Body: body}
+	NewEnvelope(ctx, val).Apply(&msg)
+	return ch.PublishWithContext(ctx, exchange, key, false, false, msg)
+}
+
+func PublishJSON[T any](ch Publisher, exchange, key string, val T) error {
+	return Publish(ch, JSONCodec, exchange, key, val)
 }
 
-func PublishGob[T any](ch *amqp.Channel, exchange, key string, val T) error {
-	var packet bytes.Buffer
-	encoder := gob.NewEncoder(&packet)
-	err := encoder.Encode(val)
+func PublishGob[T any](ch Publisher, exchange, key string, val T) error {
+	return Publish(ch, GobCodec, exchange, key, val)
+}
 
-	if err != nil {
-		panic("Gob encoding failed")
-	}
-	err = ch.PublishWithContext(
-		context.Background(),
-		exchange,
-		key,
-		false, false,
-		amqp.Publishing{ContentType: "application/gob", Body: packet.Bytes()},
-	)
-	return err
+func DeclareAndBind(b Broker, exchange, queueName, key string, simpleQueueType int, table amqp.Table) (Channel, amqp.Queue, error) {
+	return declareAndBind(b, exchange, queueName, key, simpleQueueType, table, nil)
 }
 
-func DeclareAndBind(conn *amqp.Connection, exchange, queueName, key string, simpleQueueType int, table amqp.Table) (*amqp.Channel, amqp.Queue, error) {
-	chn, err := conn.Channel()
+// declareAndBind is DeclareAndBind with binding arguments, as used by
+// headers exchanges.
+func declareAndBind(b Broker, exchange, queueName, key string, simpleQueueType int, table, bindArgs amqp.Table) (Channel, amqp.Queue, error) {
+	chn, err := b.Channel()
 	if err != nil {
 		return nil, amqp.Queue{}, fmt.Errorf("Channel creation failed: %w", err)
 	}
@@ -91,8 +93,12 @@ func DeclareAndBind(conn *amqp.Connection, exchange, queueName, key string, simp
 	if err != nil {
 		return nil, amqp.Queue{}, fmt.Errorf("Queue declaration failed: %w", err)
 	}
+	if exchange == "" {
+		// Every queue is bound to the default exchange already.
+		return chn, queue, nil
+	}
 	fmt.Printf("Binding queue %s to exchange %s with key %s\n", queue.Name, exchange, key)
-	err = chn.QueueBind(queue.Name, key, exchange, false, nil)
+	err = chn.QueueBind(queue.Name, key, exchange, false, bindArgs)
 	if err != nil {
 		fmt.Println(err)
 		return nil, amqp.Queue{}, fmt.Errorf("Queue binding failed: %w", err)
@@ -101,14 +107,11 @@ func DeclareAndBind(conn *amqp.Connection, exchange, queueName, key string, simp
 	return chn, queue, nil
 }
 
-type HandlerWithConn[T any] func(out T, conn *amqp.Connection) AckType
-type HandlerWithoutConn[T any] func(out T) AckType
-
 func DecodeJson[T any](data []byte) (T, error) {
 	var out T
 	err := json.Unmarshal(data, &out)
 	if err != nil {
-		return out, nil
+		return out, err
 	}
 	return out, nil
 }
@@ -124,62 +127,138 @@ func DecodeGob[T any](data []byte) (T, error) {
 	return out, nil
 }
 
-func Subscribe[T any](conn *amqp.Connection, exchange, queueName, key string, simpleQueueType int, handler any, unmarshaller func([]byte) (T, error)) error {
-	deadLetterTable := GetDeadLetterConfig()
-	chn, _, err := DeclareAndBind(conn, exchange, queueName, key, Durable, deadLetterTable)
+// Subscribe consumes queueName, decoding each message with the codec
+// registered for its content type and upcasting older schema versions.
+// Messages of unknown content type or that fail to decode are
+// dead-lettered.
+func Subscribe[T any](b Broker, exchange, queueName, key string, simpleQueueType int, handler Handler[T], opts ...SubscribeOption) (*Subscription, error) {
+	cfg := newSubscribeConfig(opts)
+	decode := func(msg amqp.Delivery) (T, error) {
+		return decodeVersioned[T](cfg.codecs, cfg.upcasters, msg.ContentType, EnvelopeOf(msg), msg.Body)
+	}
+	return subscribe(b, exchange, queueName, key, simpleQueueType, handler, decode, cfg)
+}
+
+func subscribe[T any](b Broker, exchange, queueName, key string, simpleQueueType int, handler Handler[T], decode func(amqp.Delivery) (T, error), cfg subscribeConfig) (*Subscription, error) {
+	var chn Channel
+	var err error
+	if cfg.existingQueue {
+		chn, err = b.Channel()
+		if err != nil {
+			return nil, fmt.Errorf("Channel creation failed: %w", err)
+		}
+	} else {
+		chn, _, err = declareAndBind(b, exchange, queueName, key, Durable, GetDeadLetterConfig(), cfg.bindArgs)
+		if err != nil {
+			return nil, fmt.Errorf("Error declaring and binding channel: %w", err)
+		}
+	}
+	var bindings []Binding
+	if !cfg.existingQueue && exchange != "" {
+		bindings = append(bindings, Binding{Exchange: exchange, Key: key, Args: cfg.bindArgs})
+	}
+	for _, bnd := range cfg.bindings {
+		err = chn.QueueBind(queueName, bnd.Key, bnd.Exchange, false, bnd.Args)
+		if err != nil {
+			chn.Close()
+			return nil, fmt.Errorf("Binding %s to %s failed: %w", queueName, bnd, err)
+		}
+		bindings = append(bindings, bnd)
+	}
+	pubCh, err := b.Channel()
 	if err != nil {
-		panic("Error declaring and binding channel")
+		chn.Close()
+		return nil, fmt.Errorf("Publishing channel creation failed: %w", err)
 	}
-    chn.Qos(10, 0, true)
+	err = chn.Qos(cfg.prefetch, 0, cfg.globalQos)
+	if err != nil {
+		chn.Close()
+		pubCh.Close()
+		return nil, fmt.Errorf("Setting QoS failed: %w", err)
+	}
+	publisher, err := NewConfirmPublisher(pubCh)
+	if err != nil {
+		chn.Close()
+		pubCh.Close()
+		return nil, err
+	}
+	consumerTag := uniqueConsumerTag()
 	msgChannel, err := chn.Consume(
-		queueName, // queue
-		"",        // consumer
-		false,     // auto-ack
-		false,     // exclusive
-		false,     // no-local
-		false,     // no-wait
-		nil,       // args
+		queueName,   // queue
+		consumerTag, // consumer
+		false,       // auto-ack
+		false,       // exclusive
+		false,       // no-local
+		false,       // no-wait
+		nil,         // args
 	)
 	if err != nil {
-		return fmt.Errorf("Failed to start consuming messages: %w", err)
+		chn.Close()
+		pubCh.Close()
+		return nil, fmt.Errorf("Failed to start consuming messages: %w", err)
 	}
-	go func() {
-		for msg := range msgChannel {
-			out, err := unmarshaller(msg.Body)
-			if err != nil {
-				log.Printf("Failed to unmarshall message: %v\n", err)
-				continue
-			}
-			log.Printf("Out message to call handler with: %v\n", out)
-            var ackType AckType
-			switch h := handler.(type) {
-			case HandlerWithConn[T]:
-				ackType = h(out, conn)
-			case HandlerWithoutConn[T]:
-				ackType = h(out)
-			default:
-                log.Printf("Unsupported handler type: %v\n", h)
-			}
-			switch ackType {
-			case Ack:
-				msg.Ack(false)
-				log.Println("Message acknowledged")
-			case NackRequeue:
-				msg.Nack(false, true)
-				log.Println("Message negatively acknowledged and re-queued")
-			case NackDiscard:
-				msg.Nack(false, false)
-				log.Println("Message negatively acknowledged and discarded")
-			}
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := &Subscription{
+		queue:       queueName,
+		consumerTag: consumerTag,
+		broker:      b,
+		ch:          chn,
+		pubCh:       pubCh,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+		bindings:    bindings,
+	}
+	retrier := newRetrier(queueName, cfg.retry, pubCh, publisher)
+	parking := newParkingLot(queueName, cfg.poisonThreshold, pubCh, publisher)
+	middleware := cfg.middleware
+	if s, ok := b.(*Subscriber); ok {
+		middleware = append(append([]Middleware{}, s.middleware...), middleware...)
+	}
+	handle := chain(func(ctx context.Context, m *Message) AckType {
+		delivery := newDelivery(m.Delivery, m.Value.(T), publisher)
+		ackType := handler(ctx, delivery)
+		if delivery.Err() != nil {
+			m.Err = delivery.Err()
 		}
+		return ackType
+	}, middleware...)
+	process := func(msg amqp.Delivery) {
+		msg = restoreRoute(msg)
+		if poison, reason := parking.isPoison(msg); poison {
+			ackType := parking.park(ctx, msg, reason)
+			parking.settled(msg, ackType)
+			settle(msg, ackType)
+			return
+		}
+		out, err := decode(msg)
+		if err != nil {
+			log.Printf("Failed to decode %q message: %v\n", msg.ContentType, err)
+			parking.settled(msg, NackDiscard)
+			msg.Nack(false, false)
+			return
+		}
+		m := &Message{Queue: queueName, Delivery: msg, Envelope: EnvelopeOf(msg), Value: out}
+		ackType := handle(ContextWithEnvelope(ctx, m.Envelope), m)
+		if ackType == Retry {
+			ackType = retrier.retry(ctx, msg, m.Err)
+		}
+		parking.settled(msg, ackType)
+		settle(msg, ackType)
+	}
+	go func() {
+		defer close(sub.done)
+		runWorkers(msgChannel, cfg.workers, cfg.orderByKey, process)
 	}()
-	return nil
-}
-
-func SubscribeJSON[T any](conn *amqp.Connection, exchange, queueName, key string, simpleQueueType int, handler any) error {
-	return Subscribe[T](conn, exchange, queueName, key, simpleQueueType, handler, DecodeJson)
+	return sub, nil
 }
 
-func SubscribeGob[T any](conn *amqp.Connection, exchange, queueName, key string, simpleQueueType int, handler any) error {
-	return Subscribe[T](conn, exchange, queueName, key, simpleQueueType, handler, DecodeGob)
+func settle(msg amqp.Delivery, ackType AckType) {
+	switch ackType {
+	case Ack:
+		msg.Ack(false)
+	case NackRequeue:
+		msg.Nack(false, true)
+	case NackDiscard:
+		msg.Nack(false, false)
+	}
 }
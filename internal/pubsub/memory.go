@@ -0,0 +1,1024 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
+
+// MemoryBroker is an in-process broker that follows RabbitMQ semantics
+// closely enough to exercise the game wiring without a running server.
+type MemoryBroker struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	exchanges map[string]*memExchange
+	queues    map[string]*memQueue
+	channels  map[*memChannel]struct{}
+	nextID    uint64
+	closes    []chan *amqp.Error
+	closed    bool
+}
+
+type memExchange struct {
+	name       string
+	kind       string
+	durable    bool
+	autoDelete bool
+	bindings   []memBinding
+}
+
+type memBinding struct {
+	queue string
+	key   string
+	args  amqp.Table
+}
+
+type memMessage struct {
+	exchange    string
+	key         string
+	msg         amqp.Publishing
+	redelivered bool
+	expiresAt   time.Time
+}
+
+type memQueue struct {
+	name       string
+	durable    bool
+	autoDelete bool
+	exclusive  bool
+	args       amqp.Table
+	ready      []memMessage
+	consumers  []*memConsumer
+	next       int
+}
+
+type memChannel struct {
+	broker    *MemoryBroker
+	prefetch  int
+	global    bool
+	nextTag   uint64
+	unacked   map[uint64]*memUnacked
+	consumers map[string]*memConsumer
+	confirm   bool
+	pubSeq    uint64
+	confirms  []chan amqp.Confirmation
+	returns   []chan amqp.Return
+	closes    []chan *amqp.Error
+	closed    bool
+	// replyTo is the pseudo-queue behind this channel's direct reply-to
+	// consumer, if it has one.
+	replyTo string
+	// notifyMu keeps confirms and returns in publish order. They are sent
+	// without the broker lock, so a listener that stops draining only
+	// blocks publishers on its own channel.
+	notifyMu sync.Mutex
+}
+
+type memUnacked struct {
+	queue    *memQueue
+	message  memMessage
+	consumer *memConsumer
+}
+
+type memConsumer struct {
+	tag       string
+	queue     *memQueue
+	ch        *memChannel
+	autoAck   bool
+	prefetch  int
+	unacked   int
+	buf       []amqp.Delivery
+	out       chan amqp.Delivery
+	done      chan struct{}
+	cancelled bool
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	b := &MemoryBroker{
+		exchanges: map[string]*memExchange{},
+		queues:    map[string]*memQueue{},
+		channels:  map[*memChannel]struct{}{},
+	}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+func (b *MemoryBroker) Channel() (Channel, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, amqp.ErrClosed
+	}
+	ch := &memChannel{
+		broker:    b,
+		unacked:   map[uint64]*memUnacked{},
+		consumers: map[string]*memConsumer{},
+	}
+	b.channels[ch] = struct{}{}
+	return ch, nil
+}
+
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return amqp.ErrClosed
+	}
+	b.closed = true
+	for ch := range b.channels {
+		ch.close()
+	}
+	for _, c := range b.closes {
+		close(c)
+	}
+	b.closes = nil
+	b.cond.Broadcast()
+	return nil
+}
+
+func (b *MemoryBroker) NotifyClose(c chan *amqp.Error) chan *amqp.Error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(c)
+	} else {
+		b.closes = append(b.closes, c)
+	}
+	return c
+}
+
+func (b *MemoryBroker) genName(prefix string) string {
+	b.nextID++
+	return fmt.Sprintf("%s-%d", prefix, b.nextID)
+}
+
+func (ch *memChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	if ex, ok := b.exchanges[name]; ok {
+		if ex.kind != kind || ex.durable != durable || ex.autoDelete != autoDelete {
+			return fmt.Errorf("Exchange %s redeclared with different settings: %w", name, ErrPreconditionFailed)
+		}
+		return nil
+	}
+	switch kind {
+	case Direct, Fanout, Topic, Headers:
+	default:
+		return fmt.Errorf("Exchange type %s is invalid: %w", kind, ErrPreconditionFailed)
+	}
+	b.exchanges[name] = &memExchange{name: name, kind: kind, durable: durable, autoDelete: autoDelete}
+	return nil
+}
+
+func (ch *memChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		return amqp.Queue{}, amqp.ErrClosed
+	}
+	if name == "" {
+		name = b.genName("amq.gen")
+	}
+	if q, ok := b.queues[name]; ok {
+		if q.durable != durable || q.autoDelete != autoDelete || q.exclusive != exclusive {
+			return amqp.Queue{}, fmt.Errorf("Queue %s redeclared with different settings: %w", name, ErrPreconditionFailed)
+		}
+		if !equalArgs(q.args, args) {
+			return amqp.Queue{}, fmt.Errorf("Queue %s redeclared with inequivalent arguments: %w", name, ErrPreconditionFailed)
+		}
+		return amqp.Queue{Name: name, Messages: len(q.ready), Consumers: len(q.consumers)}, nil
+	}
+	b.queues[name] = &memQueue{
+		name:       name,
+		durable:    durable,
+		autoDelete: autoDelete,
+		exclusive:  exclusive,
+		args:       args,
+	}
+	return amqp.Queue{Name: name}, nil
+}
+
+// equalBindArgs compares every binding argument, since a headers binding
+// is defined by them.
+func equalBindArgs(a, b amqp.Table) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, x := range a {
+		y, ok := b[k]
+		if !ok || !headerEqual(x, y) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalArgs compares the x- arguments RabbitMQ checks on redeclaration.
+func equalArgs(a, b amqp.Table) bool {
+	keys := map[string]bool{}
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	for k := range keys {
+		if !strings.HasPrefix(k, "x-") {
+			continue
+		}
+		x, xok := a[k]
+		y, yok := b[k]
+		if xok != yok {
+			return false
+		}
+		xi, xint := tableInt(x)
+		yi, yint := tableInt(y)
+		if xint && yint {
+			if xi != yi {
+				return false
+			}
+			continue
+		}
+		if fmt.Sprint(x) != fmt.Sprint(y) {
+			return false
+		}
+	}
+	return true
+}
+
+func (ch *memChannel) ExchangeDeclarePassive(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	if _, ok := b.exchanges[name]; !ok {
+		return fmt.Errorf("Exchange %s: %w", name, ErrNotFound)
+	}
+	return nil
+}
+
+func (ch *memChannel) QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		return amqp.Queue{}, amqp.ErrClosed
+	}
+	q, ok := b.queues[name]
+	if !ok {
+		return amqp.Queue{}, fmt.Errorf("Queue %s: %w", name, ErrNotFound)
+	}
+	return amqp.Queue{Name: name, Messages: len(q.ready), Consumers: len(q.consumers)}, nil
+}
+
+func (ch *memChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	if _, ok := b.queues[name]; !ok {
+		return fmt.Errorf("Queue %s: %w", name, ErrNotFound)
+	}
+	ex, ok := b.exchanges[exchange]
+	if !ok {
+		return fmt.Errorf("Exchange %s: %w", exchange, ErrNotFound)
+	}
+	for _, bnd := range ex.bindings {
+		if bnd.queue == name && bnd.key == key && equalBindArgs(bnd.args, args) {
+			return nil
+		}
+	}
+	ex.bindings = append(ex.bindings, memBinding{queue: name, key: key, args: args})
+	return nil
+}
+
+// QueueUnbind removes a binding. Removing one that does not exist is not
+// an error, as in RabbitMQ.
+func (ch *memChannel) QueueUnbind(name, key, exchange string, args amqp.Table) error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	if _, ok := b.queues[name]; !ok {
+		return fmt.Errorf("Queue %s: %w", name, ErrNotFound)
+	}
+	ex, ok := b.exchanges[exchange]
+	if !ok {
+		return fmt.Errorf("Exchange %s: %w", exchange, ErrNotFound)
+	}
+	for i, bnd := range ex.bindings {
+		if bnd.queue == name && bnd.key == key && equalBindArgs(bnd.args, args) {
+			ex.bindings = append(ex.bindings[:i], ex.bindings[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (ch *memChannel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b := ch.broker
+	b.mu.Lock()
+	if ch.closed {
+		b.mu.Unlock()
+		return amqp.ErrClosed
+	}
+	if _, ok := b.exchanges[exchange]; !ok && exchange != "" {
+		b.mu.Unlock()
+		return fmt.Errorf("Exchange %s: %w", exchange, ErrNotFound)
+	}
+	if msg.ReplyTo == DirectReplyTo {
+		if ch.replyTo == "" {
+			b.mu.Unlock()
+			return fmt.Errorf("Fast reply consumer does not exist: %w", ErrPreconditionFailed)
+		}
+		msg.ReplyTo = ch.replyTo
+	}
+	routed := b.publish(exchange, key, msg)
+	var returns []chan amqp.Return
+	if mandatory && routed == 0 {
+		returns = ch.returns
+	}
+	var confirms []chan amqp.Confirmation
+	if ch.confirm {
+		ch.pubSeq++
+		confirms = ch.confirms
+	}
+	seq := ch.pubSeq
+	ch.notifyMu.Lock()
+	b.mu.Unlock()
+	defer ch.notifyMu.Unlock()
+	// As in RabbitMQ, a mandatory message comes back before its confirm.
+	if len(returns) > 0 {
+		ret := returnFromPublishing(exchange, key, msg)
+		for _, c := range returns {
+			c <- ret
+		}
+	}
+	for _, c := range confirms {
+		c <- amqp.Confirmation{DeliveryTag: seq, Ack: true}
+	}
+	return nil
+}
+
+func returnFromPublishing(exchange, key string, msg amqp.Publishing) amqp.Return {
+	return amqp.Return{
+		ReplyCode:       amqp.NoRoute,
+		ReplyText:       "NO_ROUTE",
+		Exchange:        exchange,
+		RoutingKey:      key,
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		Headers:         msg.Headers,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		ReplyTo:         msg.ReplyTo,
+		Expiration:      msg.Expiration,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		UserId:          msg.UserId,
+		AppId:           msg.AppId,
+		Body:            msg.Body,
+	}
+}
+
+// publish routes msg and returns the number of queues it reached.
+// The broker lock must be held.
+func (b *MemoryBroker) publish(exchange, key string, msg amqp.Publishing) int {
+	queues := b.route(exchange, key, msg.Headers)
+	for _, q := range queues {
+		m := memMessage{exchange: exchange, key: key, msg: msg}
+		m.msg.Headers = copyTable(msg.Headers)
+		if ttl, ok := q.ttl(msg); ok {
+			m.expiresAt = time.Now().Add(ttl)
+			time.AfterFunc(ttl, func() {
+				b.mu.Lock()
+				defer b.mu.Unlock()
+				b.expire(q)
+			})
+		}
+		q.ready = append(q.ready, m)
+		b.dispatch(q)
+	}
+	return len(queues)
+}
+
+// ttl combines the queue's x-message-ttl with the message expiration,
+// the shorter one winning as in RabbitMQ.
+func (q *memQueue) ttl(msg amqp.Publishing) (time.Duration, bool) {
+	ttl, ok := tableInt(q.args["x-message-ttl"])
+	if msg.Expiration != "" {
+		exp, err := strconv.ParseInt(msg.Expiration, 10, 64)
+		if err == nil && (!ok || exp < ttl) {
+			ttl, ok = exp, true
+		}
+	}
+	return time.Duration(ttl) * time.Millisecond, ok
+}
+
+// expire dead-letters every ready message whose TTL has passed.
+// The broker lock must be held.
+func (b *MemoryBroker) expire(q *memQueue) {
+	if b.closed || b.queues[q.name] != q {
+		return
+	}
+	now := time.Now()
+	ready := q.ready[:0]
+	expired := []memMessage{}
+	for _, m := range q.ready {
+		if !m.expiresAt.IsZero() && !now.Before(m.expiresAt) {
+			expired = append(expired, m)
+			continue
+		}
+		ready = append(ready, m)
+	}
+	q.ready = ready
+	for _, m := range expired {
+		b.deadLetter(q, m, "expired")
+	}
+}
+
+func (b *MemoryBroker) route(exchange, key string, headers amqp.Table) []*memQueue {
+	if exchange == "" {
+		if q, ok := b.queues[key]; ok {
+			return []*memQueue{q}
+		}
+		return nil
+	}
+	ex, ok := b.exchanges[exchange]
+	if !ok {
+		return nil
+	}
+	seen := map[string]bool{}
+	queues := []*memQueue{}
+	for _, bnd := range ex.bindings {
+		if seen[bnd.queue] || !ex.matches(bnd, key, headers) {
+			continue
+		}
+		q, ok := b.queues[bnd.queue]
+		if !ok {
+			continue
+		}
+		seen[bnd.queue] = true
+		queues = append(queues, q)
+	}
+	return queues
+}
+
+func (ex *memExchange) matches(bnd memBinding, key string, headers amqp.Table) bool {
+	switch ex.kind {
+	case Direct:
+		return bnd.key == key
+	case Fanout:
+		return true
+	case Topic:
+		return topicMatch(strings.Split(bnd.key, "."), strings.Split(key, "."))
+	case Headers:
+		return headersMatch(bnd.args, headers)
+	}
+	return false
+}
+
+func topicMatch(pattern, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+	if pattern[0] == "#" {
+		for i := 0; i <= len(words); i++ {
+			if topicMatch(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(words) == 0 {
+		return false
+	}
+	if pattern[0] != "*" && pattern[0] != words[0] {
+		return false
+	}
+	return topicMatch(pattern[1:], words[1:])
+}
+
+// dispatch hands ready messages to consumers with spare prefetch capacity.
+// The broker lock must be held.
+func (b *MemoryBroker) dispatch(q *memQueue) {
+	for len(q.ready) > 0 {
+		c := q.nextConsumer()
+		if c == nil {
+			return
+		}
+		m := q.ready[0]
+		q.ready = q.ready[1:]
+		c.deliver(m)
+	}
+}
+
+func (q *memQueue) nextConsumer() *memConsumer {
+	for i := 0; i < len(q.consumers); i++ {
+		c := q.consumers[(q.next+i)%len(q.consumers)]
+		if c.hasCapacity() {
+			q.next = (q.next + i + 1) % len(q.consumers)
+			return c
+		}
+	}
+	return nil
+}
+
+func (c *memConsumer) hasCapacity() bool {
+	if c.autoAck {
+		return true
+	}
+	if c.prefetch > 0 && c.unacked >= c.prefetch {
+		return false
+	}
+	ch := c.ch
+	return !ch.global || ch.prefetch == 0 || len(ch.unacked) < ch.prefetch
+}
+
+func (c *memConsumer) deliver(m memMessage) {
+	ch := c.ch
+	d := ch.newDelivery(m, c.tag)
+	if !c.autoAck {
+		ch.unacked[d.DeliveryTag] = &memUnacked{queue: c.queue, message: m, consumer: c}
+		c.unacked++
+	}
+	c.buf = append(c.buf, d)
+	c.ch.broker.cond.Broadcast()
+}
+
+func (ch *memChannel) newDelivery(m memMessage, consumerTag string) amqp.Delivery {
+	ch.nextTag++
+	return amqp.Delivery{
+		Acknowledger:    ch,
+		Headers:         m.msg.Headers,
+		ContentType:     m.msg.ContentType,
+		ContentEncoding: m.msg.ContentEncoding,
+		DeliveryMode:    m.msg.DeliveryMode,
+		Priority:        m.msg.Priority,
+		CorrelationId:   m.msg.CorrelationId,
+		ReplyTo:         m.msg.ReplyTo,
+		Expiration:      m.msg.Expiration,
+		MessageId:       m.msg.MessageId,
+		Timestamp:       m.msg.Timestamp,
+		Type:            m.msg.Type,
+		UserId:          m.msg.UserId,
+		AppId:           m.msg.AppId,
+		ConsumerTag:     consumerTag,
+		DeliveryTag:     ch.nextTag,
+		Redelivered:     m.redelivered,
+		Exchange:        m.exchange,
+		RoutingKey:      m.key,
+		Body:            m.msg.Body,
+	}
+}
+
+func (c *memConsumer) pump() {
+	b := c.ch.broker
+	defer close(c.out)
+	for {
+		b.mu.Lock()
+		for len(c.buf) == 0 && !c.cancelled {
+			b.cond.Wait()
+		}
+		if c.cancelled {
+			b.mu.Unlock()
+			return
+		}
+		d := c.buf[0]
+		c.buf = c.buf[1:]
+		b.mu.Unlock()
+		select {
+		case c.out <- d:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// cancel stops the consumer. The broker lock must be held.
+func (c *memConsumer) cancel() {
+	if c.cancelled {
+		return
+	}
+	c.cancelled = true
+	c.buf = nil
+	close(c.done)
+	c.ch.broker.cond.Broadcast()
+}
+
+func (ch *memChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	ch.prefetch = prefetchCount
+	ch.global = global
+	return nil
+}
+
+func (ch *memChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		return nil, amqp.ErrClosed
+	}
+	if queue == DirectReplyTo {
+		if !autoAck {
+			return nil, fmt.Errorf("Direct reply-to requires auto-ack: %w", ErrPreconditionFailed)
+		}
+		if ch.replyTo != "" {
+			return nil, fmt.Errorf("Channel already consumes direct reply-to: %w", ErrPreconditionFailed)
+		}
+		// Replies are routed through a private auto-delete queue that
+		// lives as long as the consumer.
+		queue = b.genName(DirectReplyTo)
+		b.queues[queue] = &memQueue{name: queue, autoDelete: true, exclusive: true}
+		ch.replyTo = queue
+	}
+	q, ok := b.queues[queue]
+	if !ok {
+		return nil, fmt.Errorf("Queue %s: %w", queue, ErrNotFound)
+	}
+	if consumer == "" {
+		consumer = b.genName("ctag")
+	}
+	if _, ok := ch.consumers[consumer]; ok {
+		return nil, fmt.Errorf("Consumer tag %s already in use: %w", consumer, ErrPreconditionFailed)
+	}
+	c := &memConsumer{
+		tag:     consumer,
+		queue:   q,
+		ch:      ch,
+		autoAck: autoAck,
+		out:     make(chan amqp.Delivery),
+		done:    make(chan struct{}),
+	}
+	if !ch.global {
+		c.prefetch = ch.prefetch
+	}
+	ch.consumers[consumer] = c
+	q.consumers = append(q.consumers, c)
+	go c.pump()
+	b.dispatch(q)
+	return c.out, nil
+}
+
+func (ch *memChannel) Get(queue string, autoAck bool) (amqp.Delivery, bool, error) {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		return amqp.Delivery{}, false, amqp.ErrClosed
+	}
+	q, ok := b.queues[queue]
+	if !ok {
+		return amqp.Delivery{}, false, fmt.Errorf("Queue %s: %w", queue, ErrNotFound)
+	}
+	b.expire(q)
+	if len(q.ready) == 0 {
+		return amqp.Delivery{}, false, nil
+	}
+	m := q.ready[0]
+	q.ready = q.ready[1:]
+	d := ch.newDelivery(m, "")
+	d.MessageCount = uint32(len(q.ready))
+	if !autoAck {
+		ch.unacked[d.DeliveryTag] = &memUnacked{queue: q, message: m}
+	}
+	return d, true, nil
+}
+
+func (ch *memChannel) QueuePurge(name string, noWait bool) (int, error) {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		return 0, amqp.ErrClosed
+	}
+	q, ok := b.queues[name]
+	if !ok {
+		return 0, fmt.Errorf("Queue %s: %w", name, ErrNotFound)
+	}
+	n := len(q.ready)
+	q.ready = nil
+	return n, nil
+}
+
+func (ch *memChannel) Cancel(consumer string, noWait bool) error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	c, ok := ch.consumers[consumer]
+	if !ok {
+		return fmt.Errorf("Consumer %s: %w", consumer, ErrNotFound)
+	}
+	ch.removeConsumer(c)
+	return nil
+}
+
+// removeConsumer detaches c from its queue. The broker lock must be held.
+func (ch *memChannel) removeConsumer(c *memConsumer) {
+	c.cancel()
+	delete(ch.consumers, c.tag)
+	q := c.queue
+	for i, other := range q.consumers {
+		if other == c {
+			q.consumers = append(q.consumers[:i], q.consumers[i+1:]...)
+			break
+		}
+	}
+	if q.next >= len(q.consumers) {
+		q.next = 0
+	}
+	if q.autoDelete && len(q.consumers) == 0 {
+		ch.broker.deleteQueue(q)
+	}
+	if q.name == ch.replyTo {
+		ch.replyTo = ""
+	}
+}
+
+func (b *MemoryBroker) deleteQueue(q *memQueue) {
+	delete(b.queues, q.name)
+	for _, ex := range b.exchanges {
+		bindings := ex.bindings[:0]
+		for _, bnd := range ex.bindings {
+			if bnd.queue != q.name {
+				bindings = append(bindings, bnd)
+			}
+		}
+		ex.bindings = bindings
+	}
+}
+
+func (ch *memChannel) Close() error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	ch.close()
+	return nil
+}
+
+// close releases the channel's consumers and requeues its unacknowledged
+// deliveries. The broker lock must be held.
+func (ch *memChannel) close() {
+	b := ch.broker
+	ch.closed = true
+	delete(b.channels, ch)
+	for _, c := range ch.consumers {
+		ch.removeConsumer(c)
+	}
+	tags := make([]uint64, 0, len(ch.unacked))
+	for tag := range ch.unacked {
+		tags = append(tags, tag)
+	}
+	ch.settle(tags, true)
+	for _, q := range b.queues {
+		b.dispatch(q)
+	}
+	// A publisher may still be sending on the listeners, so they are
+	// closed once it is done.
+	confirms, returns := ch.confirms, ch.returns
+	ch.confirms, ch.returns = nil, nil
+	go func() {
+		ch.notifyMu.Lock()
+		defer ch.notifyMu.Unlock()
+		for _, c := range confirms {
+			close(c)
+		}
+		for _, c := range returns {
+			close(c)
+		}
+	}()
+	for _, c := range ch.closes {
+		close(c)
+	}
+	ch.closes = nil
+}
+
+func (ch *memChannel) Confirm(noWait bool) error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	ch.confirm = true
+	return nil
+}
+
+func (ch *memChannel) NotifyPublish(c chan amqp.Confirmation) chan amqp.Confirmation {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		close(c)
+	} else {
+		ch.confirms = append(ch.confirms, c)
+	}
+	return c
+}
+
+func (ch *memChannel) NotifyReturn(c chan amqp.Return) chan amqp.Return {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		close(c)
+	} else {
+		ch.returns = append(ch.returns, c)
+	}
+	return c
+}
+
+func (ch *memChannel) IsClosed() bool {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return ch.closed
+}
+
+func (ch *memChannel) NotifyClose(c chan *amqp.Error) chan *amqp.Error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		close(c)
+	} else {
+		ch.closes = append(ch.closes, c)
+	}
+	return c
+}
+
+func (ch *memChannel) Ack(tag uint64, multiple bool) error {
+	return ch.resolve(tag, multiple, func(tags []uint64) {
+		for _, t := range tags {
+			ch.forget(t)
+		}
+	})
+}
+
+func (ch *memChannel) Nack(tag uint64, multiple, requeue bool) error {
+	return ch.resolve(tag, multiple, func(tags []uint64) {
+		ch.settle(tags, requeue)
+	})
+}
+
+func (ch *memChannel) Reject(tag uint64, requeue bool) error {
+	return ch.Nack(tag, false, requeue)
+}
+
+func (ch *memChannel) resolve(tag uint64, multiple bool, fn func(tags []uint64)) error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	tags := []uint64{}
+	if multiple {
+		for t := range ch.unacked {
+			if t <= tag {
+				tags = append(tags, t)
+			}
+		}
+	} else if _, ok := ch.unacked[tag]; ok {
+		tags = append(tags, tag)
+	}
+	if len(tags) == 0 {
+		return fmt.Errorf("Delivery tag %d: %w", tag, ErrNotFound)
+	}
+	fn(tags)
+	for _, q := range b.queues {
+		b.dispatch(q)
+	}
+	return nil
+}
+
+func (ch *memChannel) forget(tag uint64) *memUnacked {
+	u := ch.unacked[tag]
+	delete(ch.unacked, tag)
+	if u.consumer != nil {
+		u.consumer.unacked--
+	}
+	return u
+}
+
+// settle requeues or dead-letters the given deliveries in tag order.
+// The broker lock must be held.
+func (ch *memChannel) settle(tags []uint64, requeue bool) {
+	slices.Sort(tags)
+	requeued := map[*memQueue][]memMessage{}
+	for _, tag := range tags {
+		u := ch.forget(tag)
+		if requeue {
+			u.message.redelivered = true
+			requeued[u.queue] = append(requeued[u.queue], u.message)
+			continue
+		}
+		ch.broker.deadLetter(u.queue, u.message, "rejected")
+	}
+	for q, msgs := range requeued {
+		q.ready = append(msgs, q.ready...)
+	}
+}
+
+// deadLetter republishes m to the queue's dead letter exchange, recording
+// the death in the x-death header the way RabbitMQ does.
+// The broker lock must be held.
+func (b *MemoryBroker) deadLetter(q *memQueue, m memMessage, reason string) {
+	dlx, ok := q.args["x-dead-letter-exchange"].(string)
+	if !ok {
+		return
+	}
+	key := m.key
+	if dlk, ok := q.args["x-dead-letter-routing-key"].(string); ok {
+		key = dlk
+	}
+	msg := m.msg
+	msg.Expiration = ""
+	msg.Headers = copyTable(msg.Headers)
+	if msg.Headers == nil {
+		msg.Headers = amqp.Table{}
+	}
+	msg.Headers["x-death"] = addDeath(msg.Headers["x-death"], q.name, reason, m.exchange, m.key)
+	if _, ok := msg.Headers["x-first-death-queue"]; !ok {
+		msg.Headers["x-first-death-queue"] = q.name
+		msg.Headers["x-first-death-reason"] = reason
+		msg.Headers["x-first-death-exchange"] = m.exchange
+	}
+	b.publish(dlx, key, msg)
+}
+
+func addDeath(existing any, queue, reason, exchange, key string) []any {
+	deaths, _ := existing.([]any)
+	for i, d := range deaths {
+		t, ok := d.(amqp.Table)
+		if !ok || t["queue"] != queue || t["reason"] != reason {
+			continue
+		}
+		entry := copyTable(t)
+		count, _ := entry["count"].(int64)
+		entry["count"] = count + 1
+		entry["time"] = time.Now()
+		out := append([]any{entry}, deaths[:i]...)
+		return append(out, deaths[i+1:]...)
+	}
+	entry := amqp.Table{
+		"count":        int64(1),
+		"reason":       reason,
+		"queue":        queue,
+		"time":         time.Now(),
+		"exchange":     exchange,
+		"routing-keys": []any{key},
+	}
+	return append([]any{entry}, deaths...)
+}
+
+func copyTable(t amqp.Table) amqp.Table {
+	if t == nil {
+		return nil
+	}
+	out := make(amqp.Table, len(t))
+	for k, v := range t {
+		out[k] = v
+	}
+	return out
+}
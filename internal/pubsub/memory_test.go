@@ -0,0 +1,200 @@
+package pubsub
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const testTimeout = 2 * time.Second
+
+func newTestChannel(t *testing.T, b *MemoryBroker) Channel {
+	t.Helper()
+	ch, err := b.Channel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ch.Close() })
+	return ch
+}
+
+func declareQueue(t *testing.T, ch Channel, name string, args amqp.Table, bindings ...[2]string) {
+	t.Helper()
+	if _, err := ch.QueueDeclare(name, true, false, false, false, args); err != nil {
+		t.Fatal(err)
+	}
+	for _, bnd := range bindings {
+		if err := ch.QueueBind(name, bnd[1], bnd[0], false, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func receive(t *testing.T, msgs <-chan amqp.Delivery) amqp.Delivery {
+	t.Helper()
+	select {
+	case d := <-msgs:
+		return d
+	case <-time.After(testTimeout):
+		t.Fatal("no message received")
+		return amqp.Delivery{}
+	}
+}
+
+func TestTopicMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		want    bool
+	}{
+		{"army_moves.*", "army_moves.alice", true},
+		{"army_moves.*", "army_moves", false},
+		{"army_moves.*", "army_moves.alice.bob", false},
+		{"#", "", true},
+		{"#", "a.b.c", true},
+		{"game_logs.#", "game_logs", true},
+		{"game_logs.#", "game_logs.alice.war", true},
+		{"*.war", "alice.war", true},
+		{"*.war", "war", false},
+		{"a.#.z", "a.z", true},
+		{"a.#.z", "a.b.c.z", true},
+		{"a.#.z", "a.b.c", false},
+		{"pause", "pause", true},
+		{"pause", "paused", false},
+	}
+	for _, tt := range tests {
+		got := topicMatch(strings.Split(tt.pattern, "."), strings.Split(tt.key, "."))
+		if got != tt.want {
+			t.Errorf("topicMatch(%q, %q) = %v, want %v", tt.pattern, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryBrokerRoutesTopics(t *testing.T) {
+	b := NewMemoryBroker()
+	ch := newTestChannel(t, b)
+	if err := CreateExchange(ch, "topic", Topic, Durable); err != nil {
+		t.Fatal(err)
+	}
+	declareQueue(t, ch, "moves", nil, [2]string{"topic", "army_moves.*"})
+	declareQueue(t, ch, "all", nil, [2]string{"topic", "#"})
+
+	for _, key := range []string{"army_moves.alice", "game_logs.alice"} {
+		err := ch.PublishWithContext(context.Background(), "topic", key, false, false, amqp.Publishing{Body: []byte(key)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for queue, want := range map[string]int{"moves": 1, "all": 2} {
+		q, err := ch.QueueDeclarePassive(queue, true, false, false, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q.Messages != want {
+			t.Errorf("queue %s has %d messages, want %d", queue, q.Messages, want)
+		}
+	}
+}
+
+func TestMemoryBrokerDeadLettersRejectedMessages(t *testing.T) {
+	b := NewMemoryBroker()
+	ch := newTestChannel(t, b)
+	CreateExchange(ch, "topic", Topic, Durable)
+	CreateExchange(ch, "dlx", Fanout, Durable)
+	declareQueue(t, ch, "work", amqp.Table{"x-dead-letter-exchange": "dlx"}, [2]string{"topic", "#"})
+	declareQueue(t, ch, "dead", nil, [2]string{"dlx", ""})
+
+	ch.PublishWithContext(context.Background(), "topic", "game_logs.alice", false, false, amqp.Publishing{Body: []byte("log")})
+	msgs, err := ch.Consume("work", "", false, false, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := receive(t, msgs)
+	if err := d.Nack(false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	dead, ok, err := ch.Get("dead", true)
+	if err != nil || !ok {
+		t.Fatalf("dead letter queue is empty: %v", err)
+	}
+	if dead.Headers["x-first-death-queue"] != "work" || dead.Headers["x-first-death-reason"] != "rejected" {
+		t.Errorf("unexpected first death headers: %v", dead.Headers)
+	}
+	deaths, _ := dead.Headers["x-death"].([]any)
+	if len(deaths) != 1 {
+		t.Fatalf("unexpected x-death: %v", dead.Headers["x-death"])
+	}
+	if death, _ := deaths[0].(amqp.Table); death["queue"] != "work" || death["count"] != int64(1) {
+		t.Errorf("unexpected x-death entry: %v", deaths[0])
+	}
+	if dead.RoutingKey != "game_logs.alice" {
+		t.Errorf("dead letter routing key = %q, want the original", dead.RoutingKey)
+	}
+}
+
+func TestMemoryBrokerRequeuesAsRedelivered(t *testing.T) {
+	b := NewMemoryBroker()
+	ch := newTestChannel(t, b)
+	declareQueue(t, ch, "work", nil)
+	ch.PublishWithContext(context.Background(), "", "work", false, false, amqp.Publishing{Body: []byte("x")})
+	msgs, _ := ch.Consume("work", "", false, false, false, false, nil)
+
+	first := receive(t, msgs)
+	if first.Redelivered {
+		t.Error("first delivery is marked redelivered")
+	}
+	first.Nack(false, true)
+	second := receive(t, msgs)
+	if !second.Redelivered {
+		t.Error("requeued delivery is not marked redelivered")
+	}
+	second.Ack(false)
+}
+
+func TestMemoryBrokerExpiresMessages(t *testing.T) {
+	b := NewMemoryBroker()
+	ch := newTestChannel(t, b)
+	CreateExchange(ch, "dlx", Fanout, Durable)
+	declareQueue(t, ch, "short", amqp.Table{"x-message-ttl": int32(20), "x-dead-letter-exchange": "dlx"})
+	declareQueue(t, ch, "dead", nil, [2]string{"dlx", ""})
+
+	// The shorter of the queue TTL and the message expiration wins.
+	ch.PublishWithContext(context.Background(), "", "short", false, false, amqp.Publishing{Body: []byte("queue ttl")})
+	ch.PublishWithContext(context.Background(), "", "short", false, false, amqp.Publishing{Body: []byte("message ttl"), Expiration: "5"})
+
+	msgs, _ := ch.Consume("dead", "", true, false, false, false, nil)
+	got := []string{string(receive(t, msgs).Body), string(receive(t, msgs).Body)}
+	if got[0] != "message ttl" || got[1] != "queue ttl" {
+		t.Errorf("expired in order %v, want the shorter TTL first", got)
+	}
+	if _, ok, _ := ch.Get("short", true); ok {
+		t.Error("expired message is still in its queue")
+	}
+}
+
+// A listener that stops draining must not block the rest of the broker.
+func TestMemoryBrokerStalledListener(t *testing.T) {
+	b := NewMemoryBroker()
+	stalled := newTestChannel(t, b)
+	declareQueue(t, stalled, "work", nil)
+	stalled.Confirm(false)
+	stalled.NotifyPublish(make(chan amqp.Confirmation))
+	go stalled.PublishWithContext(context.Background(), "", "work", false, false, amqp.Publishing{})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		other := newTestChannel(t, b)
+		declareQueue(t, other, "other", nil)
+		other.PublishWithContext(context.Background(), "", "other", false, false, amqp.Publishing{})
+	}()
+	select {
+	case <-done:
+	case <-time.After(testTimeout):
+		t.Fatal("a stalled confirm listener blocked another channel")
+	}
+}
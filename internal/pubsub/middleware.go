@@ -0,0 +1,186 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Message is the type-erased view of a delivery that middleware works on.
+type Message struct {
+	Queue    string
+	Delivery amqp.Delivery
+	Envelope Envelope
+	// Value is the decoded body, of the subscription's type T.
+	Value any
+	// Err is the last error reported by the handler or a middleware.
+	Err error
+}
+
+type HandlerFunc func(ctx context.Context, m *Message) AckType
+
+// Middleware wraps a HandlerFunc with cross-cutting behaviour.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// chain applies mws so that the first one is the outermost.
+func chain(h HandlerFunc, mws ...Middleware) HandlerFunc {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// Subscriber carries middleware that applies to every subscription made
+// through it. It is a Broker, so it can be passed to Subscribe directly.
+type Subscriber struct {
+	Broker
+	middleware []Middleware
+}
+
+func NewSubscriber(b Broker, mws ...Middleware) *Subscriber {
+	return &Subscriber{Broker: b, middleware: mws}
+}
+
+func (s *Subscriber) Use(mws ...Middleware) {
+	s.middleware = append(s.middleware, mws...)
+}
+
+// Recover turns a panicking handler into the given ack decision.
+func Recover(onPanic AckType) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, m *Message) (ack AckType) {
+			defer func() {
+				if r := recover(); r != nil {
+					m.Err = fmt.Errorf("handler panicked: %v\n%s", r, debug.Stack())
+					ack = onPanic
+				}
+			}()
+			return next(ctx, m)
+		}
+	}
+}
+
+// Timing reports how long each message took to handle.
+func Timing(observe func(queue string, elapsed time.Duration, ack AckType)) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, m *Message) AckType {
+			start := time.Now()
+			ack := next(ctx, m)
+			observe(m.Queue, time.Since(start), ack)
+			return ack
+		}
+	}
+}
+
+// Logging logs every message and its outcome.
+func Logging(logger *slog.Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, m *Message) AckType {
+			start := time.Now()
+			ack := next(ctx, m)
+			attrs := []any{
+				"queue", m.Queue,
+				"exchange", m.Delivery.Exchange,
+				"routing_key", m.Delivery.RoutingKey,
+				"redelivered", m.Delivery.Redelivered,
+				"message_id", m.Envelope.MessageID,
+				"type", m.Envelope.Type,
+				"correlation_id", m.Envelope.CorrelationID,
+				"ack", ack,
+				"elapsed", time.Since(start),
+			}
+			if m.Err != nil {
+				logger.ErrorContext(ctx, "message handled", append(attrs, "error", m.Err)...)
+			} else {
+				logger.InfoContext(ctx, "message handled", attrs...)
+			}
+			return ack
+		}
+	}
+}
+
+// Validate rejects messages whose decoded body fails fn. Invalid messages
+// are discarded, which dead-letters them.
+func Validate[T any](fn func(T) error) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, m *Message) AckType {
+			val, ok := m.Value.(T)
+			if !ok {
+				return next(ctx, m)
+			}
+			if err := fn(val); err != nil {
+				m.Err = fmt.Errorf("invalid message: %w", err)
+				return NackDiscard
+			}
+			return next(ctx, m)
+		}
+	}
+}
+
+// Tracer starts a span for a message. The returned function ends it.
+type Tracer interface {
+	StartSpan(ctx context.Context, name string, headers amqp.Table) (context.Context, func(ack AckType, err error))
+}
+
+func Tracing(tracer Tracer) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, m *Message) AckType {
+			ctx, end := tracer.StartSpan(ctx, "consume "+m.Queue, m.Delivery.Headers)
+			ack := next(ctx, m)
+			end(ack, m.Err)
+			return ack
+		}
+	}
+}
+
+// HandlerMetrics counts handled messages per queue and outcome.
+type HandlerMetrics struct {
+	mu      sync.Mutex
+	counts  map[string]map[AckType]int64
+	elapsed map[string]time.Duration
+}
+
+type QueueMetrics struct {
+	Counts  map[AckType]int64
+	Elapsed time.Duration
+}
+
+func NewHandlerMetrics() *HandlerMetrics {
+	return &HandlerMetrics{
+		counts:  map[string]map[AckType]int64{},
+		elapsed: map[string]time.Duration{},
+	}
+}
+
+func (hm *HandlerMetrics) Middleware() Middleware {
+	return Timing(hm.observe)
+}
+
+func (hm *HandlerMetrics) observe(queue string, elapsed time.Duration, ack AckType) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	if hm.counts[queue] == nil {
+		hm.counts[queue] = map[AckType]int64{}
+	}
+	hm.counts[queue][ack]++
+	hm.elapsed[queue] += elapsed
+}
+
+func (hm *HandlerMetrics) Snapshot() map[string]QueueMetrics {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	out := make(map[string]QueueMetrics, len(hm.counts))
+	for queue, counts := range hm.counts {
+		qm := QueueMetrics{Counts: map[AckType]int64{}, Elapsed: hm.elapsed[queue]}
+		for ack, n := range counts {
+			qm.Counts[ack] = n
+		}
+		out[queue] = qm
+	}
+	return out
+}
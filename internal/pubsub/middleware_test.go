@@ -0,0 +1,106 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func recordOrder(mu *sync.Mutex, order *[]string, name string) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, m *Message) AckType {
+			mu.Lock()
+			*order = append(*order, name+" in")
+			mu.Unlock()
+			ack := next(ctx, m)
+			mu.Lock()
+			*order = append(*order, name+" out")
+			mu.Unlock()
+			return ack
+		}
+	}
+}
+
+func TestChainRunsFirstMiddlewareOutermost(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	h := chain(func(ctx context.Context, m *Message) AckType {
+		order = append(order, "handler")
+		return Ack
+	}, recordOrder(&mu, &order, "a"), recordOrder(&mu, &order, "b"))
+	h(context.Background(), &Message{})
+	want := []string{"a in", "b in", "handler", "b out", "a out"}
+	if !slices.Equal(order, want) {
+		t.Errorf("ran in order %v, want %v", order, want)
+	}
+}
+
+// Subscriber middleware wraps the subscription's own middleware.
+func TestSubscriberMiddlewareOrder(t *testing.T) {
+	b := NewMemoryBroker()
+	ch := newTestChannel(t, b)
+	CreateExchange(ch, "topic", Topic, Durable)
+
+	var mu sync.Mutex
+	var order []string
+	s := NewSubscriber(b, recordOrder(&mu, &order, "subscriber"))
+	s.Use(recordOrder(&mu, &order, "used"))
+	done := make(chan struct{})
+	sub, err := Subscribe(s, "topic", "logs", "game_logs.*", Durable,
+		func(ctx context.Context, d *Delivery[string]) AckType {
+			mu.Lock()
+			order = append(order, "handler")
+			mu.Unlock()
+			close(done)
+			return Ack
+		},
+		WithMiddleware(recordOrder(&mu, &order, "option")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	PublishJSON(ch, "topic", "game_logs.alice", "log")
+	select {
+	case <-done:
+	case <-time.After(testTimeout):
+		t.Fatal("handler never ran")
+	}
+	sub.Close(context.Background())
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"subscriber in", "used in", "option in", "handler", "option out", "used out", "subscriber out"}
+	if !slices.Equal(order, want) {
+		t.Errorf("ran in order %v, want %v", order, want)
+	}
+}
+
+func TestRecoverAndValidate(t *testing.T) {
+	panics := chain(func(ctx context.Context, m *Message) AckType {
+		panic("boom")
+	}, Recover(NackDiscard))
+	m := &Message{}
+	if ack := panics(context.Background(), m); ack != NackDiscard || m.Err == nil {
+		t.Errorf("panicking handler settled as %v with error %v", ack, m.Err)
+	}
+
+	errOdd := errors.New("odd")
+	validated := chain(func(ctx context.Context, m *Message) AckType {
+		return Ack
+	}, Validate(func(n int) error {
+		if n%2 == 1 {
+			return errOdd
+		}
+		return nil
+	}))
+	if ack := validated(context.Background(), &Message{Value: 2}); ack != Ack {
+		t.Errorf("valid message settled as %v", ack)
+	}
+	m = &Message{Value: 3}
+	if ack := validated(context.Background(), m); ack != NackDiscard || !errors.Is(m.Err, errOdd) {
+		t.Errorf("invalid message settled as %v with error %v", ack, m.Err)
+	}
+}
@@ -0,0 +1,385 @@
+package pubsub
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// outboxConfirmTimeout bounds the wait for a confirm. A message whose
+// confirm was lost with its connection is published again, so consumers
+// may see it twice and should be Idempotent.
+const outboxConfirmTimeout = 10 * time.Second
+
+// outboxRecord is one line of the spool: either a message waiting to be
+// published or the acknowledgement that message Seq was confirmed.
+type outboxRecord struct {
+	Seq       uint64           `json:"seq"`
+	Ack       bool             `json:"ack,omitempty"`
+	Exchange  string           `json:"exchange,omitempty"`
+	Key       string           `json:"key,omitempty"`
+	Mandatory bool             `json:"mandatory,omitempty"`
+	Msg       *amqp.Publishing `json:"msg,omitempty"`
+}
+
+// Outbox is a Publisher that appends messages to a local spool file
+// instead of sending them. A relay drains the spool to the broker in order
+// with publisher confirms and forgets a message only once it has been
+// confirmed, so a message accepted by the outbox survives broker outages
+// and restarts. Unroutable mandatory messages are logged and dropped.
+type Outbox struct {
+	broker Broker
+	path   string
+
+	mu      sync.Mutex
+	f       *os.File
+	seq     uint64
+	pending []outboxRecord
+	lines   int
+	waiters []chan struct{}
+	closed  bool
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewOutbox opens the spool at path, creating it if needed, and starts
+// relaying whatever an earlier run left in it.
+func NewOutbox(b Broker, path string) (*Outbox, error) {
+	o := &Outbox{
+		broker: b,
+		path:   path,
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if err := o.load(); err != nil {
+		return nil, err
+	}
+	if err := o.rewrite(); err != nil {
+		return nil, fmt.Errorf("Compacting outbox failed: %w", err)
+	}
+	go o.relay()
+	o.notify()
+	return o, nil
+}
+
+func (o *Outbox) load() error {
+	f, err := os.Open(o.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Opening outbox failed: %w", err)
+	}
+	defer f.Close()
+	acked := map[uint64]bool{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var rec outboxRecord
+		dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		dec.UseNumber()
+		if err := dec.Decode(&rec); err != nil {
+			// A crash mid-append leaves a torn last line; that message
+			// was never accepted.
+			log.Printf("Skipping corrupt outbox record: %v\n", err)
+			continue
+		}
+		o.seq = max(o.seq, rec.Seq)
+		if rec.Ack {
+			acked[rec.Seq] = true
+			continue
+		}
+		if rec.Msg != nil {
+			rec.Msg.Headers = restoreTable(rec.Msg.Headers)
+			o.pending = append(o.pending, rec)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Reading outbox failed: %w", err)
+	}
+	live := o.pending[:0]
+	for _, rec := range o.pending {
+		if !acked[rec.Seq] {
+			live = append(live, rec)
+		}
+	}
+	o.pending = live
+	return nil
+}
+
+// restoreTable turns the JSON numbers and maps of a decoded header table
+// back into the types amqp accepts.
+func restoreTable(t amqp.Table) amqp.Table {
+	if t == nil {
+		return nil
+	}
+	out := amqp.Table{}
+	for k, v := range t {
+		out[k] = restoreValue(v)
+	}
+	return out
+}
+
+func restoreValue(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		return restoreTable(v)
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = restoreValue(e)
+		}
+		return out
+	}
+	return v
+}
+
+// rewrite replaces the spool with just the pending messages. The lock
+// must be held or the relay not yet running.
+func (o *Outbox) rewrite() error {
+	tmp := o.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, rec := range o.pending {
+		if err := enc.Encode(rec); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	f.Close()
+	if err := os.Rename(tmp, o.path); err != nil {
+		return err
+	}
+	if o.f != nil {
+		o.f.Close()
+	}
+	o.f, err = os.OpenFile(o.path, os.O_APPEND|os.O_WRONLY, 0644)
+	o.lines = len(o.pending)
+	return err
+}
+
+// append writes rec to the spool and syncs it. The lock must be held.
+func (o *Outbox) append(rec outboxRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := o.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	o.lines++
+	return o.f.Sync()
+}
+
+func (o *Outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// PublishWithContext stores msg in the spool. It returns once the message
+// is durable locally, not once the broker has it.
+func (o *Outbox) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return amqp.ErrClosed
+	}
+	rec := outboxRecord{
+		Seq:       o.seq + 1,
+		Exchange:  exchange,
+		Key:       key,
+		Mandatory: mandatory,
+		Msg:       &msg,
+	}
+	if err := o.append(rec); err != nil {
+		return fmt.Errorf("Writing to outbox failed: %w", err)
+	}
+	o.seq = rec.Seq
+	o.pending = append(o.pending, rec)
+	o.notify()
+	return nil
+}
+
+// Pending returns how many messages are waiting to be confirmed.
+func (o *Outbox) Pending() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.pending)
+}
+
+// Flush waits until every message accepted so far has been confirmed.
+func (o *Outbox) Flush(ctx context.Context) error {
+	o.mu.Lock()
+	if len(o.pending) == 0 {
+		o.mu.Unlock()
+		return nil
+	}
+	drained := make(chan struct{})
+	o.waiters = append(o.waiters, drained)
+	o.mu.Unlock()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops the relay. Messages that were not confirmed yet stay in the
+// spool and are sent by the next Outbox opened on it.
+func (o *Outbox) Close() error {
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		return nil
+	}
+	o.closed = true
+	o.mu.Unlock()
+	close(o.stop)
+	<-o.done
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.f.Close()
+}
+
+func (o *Outbox) head() (outboxRecord, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.pending) == 0 {
+		return outboxRecord{}, false
+	}
+	return o.pending[0], true
+}
+
+// confirmed forgets the head of the spool.
+func (o *Outbox) confirmed(seq uint64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.pending = o.pending[1:]
+	var err error
+	if len(o.pending) == 0 || o.lines > 2*len(o.pending)+1024 {
+		err = o.rewrite()
+	} else {
+		err = o.append(outboxRecord{Seq: seq, Ack: true})
+	}
+	if len(o.pending) == 0 {
+		for _, w := range o.waiters {
+			close(w)
+		}
+		o.waiters = nil
+	}
+	return err
+}
+
+// sleep waits for d or until the outbox is closed.
+func (o *Outbox) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-o.stop:
+		return false
+	}
+}
+
+func (o *Outbox) relay() {
+	defer close(o.done)
+	var publisher *ConfirmPublisher
+	defer func() {
+		if publisher != nil {
+			publisher.Close()
+		}
+	}()
+	delay := minReconnectDelay
+	backOff := func() bool {
+		if publisher != nil {
+			publisher.Close()
+			publisher = nil
+		}
+		ok := o.sleep(delay)
+		delay = min(2*delay, maxReconnectDelay)
+		return ok
+	}
+
+	for {
+		rec, ok := o.head()
+		if !ok {
+			select {
+			case <-o.wake:
+				continue
+			case <-o.stop:
+				return
+			}
+		}
+		select {
+		case <-o.stop:
+			return
+		default:
+		}
+		if publisher == nil {
+			ch, err := o.broker.Channel()
+			if err == nil {
+				publisher, err = NewConfirmPublisher(ch)
+				if err != nil {
+					ch.Close()
+				}
+			}
+			if err != nil {
+				log.Printf("Outbox cannot reach the broker: %v\n", err)
+				if !backOff() {
+					return
+				}
+				continue
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), outboxConfirmTimeout)
+		err := publisher.PublishWithContext(ctx, rec.Exchange, rec.Key, rec.Mandatory, false, *rec.Msg)
+		cancel()
+		var unroutable *UnroutableError
+		if errors.As(err, &unroutable) {
+			log.Printf("Dropping outbox message %d: %v\n", rec.Seq, err)
+		} else if err != nil {
+			log.Printf("Relaying outbox message %d failed: %v\n", rec.Seq, err)
+			if !backOff() {
+				return
+			}
+			continue
+		}
+		delay = minReconnectDelay
+		if err := o.confirmed(rec.Seq); err != nil {
+			log.Printf("Updating outbox failed: %v\n", err)
+		}
+	}
+}
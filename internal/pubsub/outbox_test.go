@@ -0,0 +1,78 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Messages that could not be relayed are sent by the next outbox opened
+// on the spool, in order and with their headers intact.
+func TestOutboxReplaysAfterFailedFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.outbox")
+	down := NewMemoryBroker()
+	down.Close()
+	o, err := NewOutbox(down, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 2; i++ {
+		msg := amqp.Publishing{Headers: amqp.Table{"n": i}}
+		if err := o.PublishWithContext(context.Background(), "", "logs", false, false, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := o.Flush(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("flush without a broker returned %v", err)
+	}
+	if n := o.Pending(); n != 2 {
+		t.Errorf("%d messages pending, want 2", n)
+	}
+	o.Close()
+
+	b := NewMemoryBroker()
+	ch := newTestChannel(t, b)
+	declareQueue(t, ch, "logs", nil)
+	o, err = NewOutbox(b, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	ctx, cancel = context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	if err := o.Flush(ctx); err != nil {
+		t.Fatalf("flush after the restart failed: %v", err)
+	}
+	for want := int64(1); want <= 2; want++ {
+		d, ok, err := ch.Get("logs", true)
+		if err != nil || !ok {
+			t.Fatalf("message %d was not relayed: %v", want, err)
+		}
+		if d.Headers["n"] != want {
+			t.Errorf("got header n=%#v, want %d", d.Headers["n"], want)
+		}
+	}
+}
+
+func TestOutboxDropsUnroutable(t *testing.T) {
+	b := NewMemoryBroker()
+	o, err := NewOutbox(b, filepath.Join(t.TempDir(), "server.outbox"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	if err := o.PublishWithContext(context.Background(), "", "nowhere", true, false, amqp.Publishing{}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	if err := o.Flush(ctx); err != nil {
+		t.Errorf("unroutable message blocked the outbox: %v", err)
+	}
+}
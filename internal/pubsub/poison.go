@@ -0,0 +1,155 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const DefaultPoisonThreshold = 10
+
+const (
+	LastErrorHeader    = "x-last-error"
+	PoisonReasonHeader = "x-poison-reason"
+	OriginQueueHeader  = "x-origin-queue"
+)
+
+var (
+	parkedMu     sync.Mutex
+	parkedCounts = map[string]int64{}
+)
+
+// ParkedCounts reports how many poison messages were parked per origin queue.
+func ParkedCounts() map[string]int64 {
+	parkedMu.Lock()
+	defer parkedMu.Unlock()
+	out := make(map[string]int64, len(parkedCounts))
+	for k, v := range parkedCounts {
+		out[k] = v
+	}
+	return out
+}
+
+func ParkingLotQueueName(queue string) string {
+	return queue + ".parking_lot"
+}
+
+// DeliveryCount estimates how many times msg has been delivered, including
+// this delivery, from the quorum queue x-delivery-count header and the
+// x-death history left by dead-lettering and retries. Classic queues do
+// not count requeues, which the parking lot tracks itself.
+func DeliveryCount(msg amqp.Delivery) int {
+	count, _ := tableInt(msg.Headers["x-delivery-count"])
+	for _, d := range Deaths(msg.Headers) {
+		count += d.Count
+	}
+	return int(count) + 1
+}
+
+// parkingLot moves poison messages out of the way into a per-queue
+// parking lot so that they stop cycling through the consumer.
+type parkingLot struct {
+	queue     string
+	threshold int
+	ch        Channel
+	pub       Publisher
+
+	mu       sync.Mutex
+	declared bool
+	// requeues counts NackRequeue settlements per message ID.
+	requeues map[string]int
+}
+
+func newParkingLot(queue string, threshold int, ch Channel, pub Publisher) *parkingLot {
+	return &parkingLot{queue: queue, threshold: threshold, ch: ch, pub: pub, requeues: map[string]int{}}
+}
+
+func (p *parkingLot) isPoison(msg amqp.Delivery) (bool, string) {
+	if p.threshold <= 0 {
+		return false, ""
+	}
+	p.mu.Lock()
+	count := DeliveryCount(msg) + p.requeues[msg.MessageId]
+	p.mu.Unlock()
+	if count < p.threshold {
+		return false, ""
+	}
+	return true, fmt.Sprintf("delivered %d times, threshold is %d", count, p.threshold)
+}
+
+func (p *parkingLot) park(ctx context.Context, msg amqp.Delivery, reason string) AckType {
+	name := ParkingLotQueueName(p.queue)
+	if err := p.declare(name); err != nil {
+		log.Printf("Parking lot declaration failed: %v\n", err)
+		return NackDiscard
+	}
+	headers := copyTable(msg.Headers)
+	if headers == nil {
+		headers = amqp.Table{}
+	}
+	headers[PoisonReasonHeader] = reason
+	headers[OriginQueueHeader] = p.queue
+	publishing := publishingFromDelivery(msg)
+	publishing.Headers = headers
+	err := p.pub.PublishWithContext(ctx, "", name, false, false, publishing)
+	if err != nil {
+		log.Printf("Parking poison message failed: %v\n", err)
+		return NackDiscard
+	}
+	parkedMu.Lock()
+	parkedCounts[p.queue]++
+	parkedMu.Unlock()
+	log.Printf("Poison message on %s parked in %s: %s\n", p.queue, name, reason)
+	return Ack
+}
+
+// settled records how msg was settled, so that a message requeued over
+// and over is recognised as poison.
+func (p *parkingLot) settled(msg amqp.Delivery, ackType AckType) {
+	if msg.MessageId == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ackType == NackRequeue {
+		p.requeues[msg.MessageId]++
+		return
+	}
+	delete(p.requeues, msg.MessageId)
+}
+
+func (p *parkingLot) declare(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.declared {
+		return nil
+	}
+	_, err := p.ch.QueueDeclare(name, true, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+	p.declared = true
+	return nil
+}
+
+func publishingFromDelivery(msg amqp.Delivery) amqp.Publishing {
+	return amqp.Publishing{
+		Headers:         msg.Headers,
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		ReplyTo:         msg.ReplyTo,
+		Expiration:      msg.Expiration,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		UserId:          msg.UserId,
+		AppId:           msg.AppId,
+		Body:            msg.Body,
+	}
+}
@@ -0,0 +1,84 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Classic queues carry no delivery count, so a message the handler keeps
+// requeueing must still end up in the parking lot.
+func TestRequeueLoopIsParked(t *testing.T) {
+	b := NewMemoryBroker()
+	ch := newTestChannel(t, b)
+	CreateExchange(ch, "topic", Topic, Durable)
+
+	parked := ParkedCounts()["logs"]
+	var handled atomic.Int64
+	_, err := Subscribe(b, "topic", "logs", "game_logs.*", Durable,
+		func(ctx context.Context, d *Delivery[string]) AckType {
+			handled.Add(1)
+			return NackRequeue
+		},
+		WithPoisonThreshold(5),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := PublishJSON(ch, "topic", "game_logs.alice", "log"); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(testTimeout)
+	for {
+		// The parking lot is declared when the first message is parked.
+		d, ok, err := ch.Get(ParkingLotQueueName("logs"), true)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			t.Fatal(err)
+		}
+		if ok {
+			if d.Headers[OriginQueueHeader] != "logs" {
+				t.Errorf("parked message came from %v", d.Headers[OriginQueueHeader])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("message was not parked after %d deliveries", handled.Load())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := handled.Load(); n != 4 {
+		t.Errorf("handler saw the message %d times, want 4", n)
+	}
+	if n := ParkedCounts()["logs"] - parked; n != 1 {
+		t.Errorf("parked count went up by %d, want 1", n)
+	}
+}
+
+// A message that keeps dead-lettering back to its queue is counted from
+// its x-death history.
+func TestDeliveryCountFromDeaths(t *testing.T) {
+	b := NewMemoryBroker()
+	ch := newTestChannel(t, b)
+	CreateExchange(ch, "dlx", Fanout, Durable)
+	declareQueue(t, ch, "work", amqp.Table{"x-dead-letter-exchange": "dlx"}, [2]string{"dlx", ""})
+	ch.PublishWithContext(context.Background(), "", "work", false, false, amqp.Publishing{Body: []byte("x")})
+	msgs, err := ch.Consume("work", "", false, false, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for want := 1; want <= 3; want++ {
+		d := receive(t, msgs)
+		if got := DeliveryCount(d); got != want {
+			t.Errorf("delivery %d counted as %d", want, got)
+		}
+		d.Nack(false, false)
+	}
+	if n := DeliveryCount(amqp.Delivery{Headers: amqp.Table{"x-delivery-count": int64(2)}}); n != 3 {
+		t.Errorf("quorum delivery count 2 counted as %d, want 3", n)
+	}
+}
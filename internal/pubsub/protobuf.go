@@ -0,0 +1,186 @@
+package pubsub
+
+import (
+	"fmt"
+	"mime"
+	"reflect"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const ContentTypeProtobuf = "application/x-protobuf"
+
+// protoMessageParam names the message type in the content type, e.g.
+// "application/x-protobuf; proto=peril.v1.GameLog", so consumers in any
+// language know what to decode.
+const protoMessageParam = "proto"
+
+type protoConversion struct {
+	newMessage func() proto.Message
+	toProto    func(v any) proto.Message
+	fromProto  func(m proto.Message) any
+}
+
+// ProtoCodec encodes protobuf messages. Plain Go types can be sent and
+// received too once a conversion to their message type is registered
+// with RegisterProtoConversion.
+type ProtoCodec struct {
+	mu          sync.RWMutex
+	conversions map[reflect.Type]protoConversion
+	// order is the registration order, so that the first Go type
+	// registered for a message wins when decoding into an interface.
+	order []reflect.Type
+}
+
+func NewProtoCodec() *ProtoCodec {
+	return &ProtoCodec{conversions: map[reflect.Type]protoConversion{}}
+}
+
+// ProtobufCodec is registered in DefaultCodecs.
+var ProtobufCodec = NewProtoCodec()
+
+func init() {
+	DefaultCodecs.Register(ProtobufCodec)
+}
+
+// RegisterProtoConversion lets c carry values of type T as messages of
+// type M.
+func RegisterProtoConversion[T any, M proto.Message](c *ProtoCodec, toProto func(T) M, fromProto func(M) T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := reflect.TypeFor[T]()
+	if _, ok := c.conversions[t]; !ok {
+		c.order = append(c.order, t)
+	}
+	c.conversions[t] = protoConversion{
+		// Resolved on use: registration may run before the generated
+		// package has initialised its descriptors.
+		newMessage: func() proto.Message {
+			var zero M
+			return zero.ProtoReflect().Type().New().Interface()
+		},
+		toProto:   func(v any) proto.Message { return toProto(v.(T)) },
+		fromProto: func(m proto.Message) any { return fromProto(m.(M)) },
+	}
+}
+
+func (c *ProtoCodec) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+// ContentTypeOf adds the message type of v as a parameter.
+func (c *ProtoCodec) ContentTypeOf(v any) string {
+	m, err := c.message(v)
+	if err != nil {
+		return ContentTypeProtobuf
+	}
+	return mime.FormatMediaType(ContentTypeProtobuf, map[string]string{
+		protoMessageParam: string(m.ProtoReflect().Descriptor().FullName()),
+	})
+}
+
+func (c *ProtoCodec) message(v any) (proto.Message, error) {
+	if m, ok := v.(proto.Message); ok {
+		return m, nil
+	}
+	c.mu.RLock()
+	conv, ok := c.conversions[reflect.TypeOf(v)]
+	c.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%T is not a protobuf message and has no registered conversion", v)
+	}
+	return conv.toProto(v), nil
+}
+
+func (c *ProtoCodec) Marshal(v any) ([]byte, error) {
+	m, err := c.message(v)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(m)
+}
+
+// Unmarshal decodes into a proto.Message, a pointer to a nil message
+// pointer, or a pointer to a type with a registered conversion.
+func (c *ProtoCodec) Unmarshal(data []byte, v any) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+	ptr := reflect.ValueOf(v)
+	if ptr.Kind() != reflect.Pointer || ptr.IsNil() {
+		return fmt.Errorf("cannot decode protobuf into %T", v)
+	}
+	target := ptr.Elem()
+	if target.Kind() == reflect.Pointer {
+		if m, ok := reflect.New(target.Type().Elem()).Interface().(proto.Message); ok {
+			if err := proto.Unmarshal(data, m); err != nil {
+				return err
+			}
+			target.Set(reflect.ValueOf(m))
+			return nil
+		}
+	}
+	c.mu.RLock()
+	conv, ok := c.conversions[target.Type()]
+	c.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%s is not a protobuf message and has no registered conversion", target.Type())
+	}
+	m := conv.newMessage()
+	if err := proto.Unmarshal(data, m); err != nil {
+		return err
+	}
+	target.Set(reflect.ValueOf(conv.fromProto(m)))
+	return nil
+}
+
+// UnmarshalContentType is Unmarshal that can also decode into an
+// interface such as *any, using the message type named in contentType
+// and the Go type registered for it first.
+func (c *ProtoCodec) UnmarshalContentType(contentType string, data []byte, v any) error {
+	ptr := reflect.ValueOf(v)
+	if ptr.Kind() != reflect.Pointer || ptr.IsNil() || ptr.Elem().Kind() != reflect.Interface {
+		return c.Unmarshal(data, v)
+	}
+	msgType, err := ProtoMessageType(contentType)
+	if err != nil {
+		return err
+	}
+	m := msgType.New().Interface()
+	if err := proto.Unmarshal(data, m); err != nil {
+		return err
+	}
+	var out any = m
+	c.mu.RLock()
+	for _, t := range c.order {
+		conv := c.conversions[t]
+		if conv.newMessage().ProtoReflect().Descriptor().FullName() == msgType.Descriptor().FullName() {
+			out = conv.fromProto(m)
+			break
+		}
+	}
+	c.mu.RUnlock()
+	val := reflect.ValueOf(out)
+	if !val.Type().AssignableTo(ptr.Elem().Type()) {
+		return fmt.Errorf("cannot decode %s into %s", msgType.Descriptor().FullName(), ptr.Elem().Type())
+	}
+	ptr.Elem().Set(val)
+	return nil
+}
+
+// ProtoMessageType returns the registered message type named in a
+// protobuf content type, for tools that handle any Peril message.
+func ProtoMessageType(contentType string) (protoreflect.MessageType, error) {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+	name := params[protoMessageParam]
+	if name == "" {
+		return nil, fmt.Errorf("content type %q does not name a message type", contentType)
+	}
+	return protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(name))
+}
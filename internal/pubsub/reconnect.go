@@ -0,0 +1,802 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	minReconnectDelay     = 500 * time.Millisecond
+	maxReconnectDelay     = 30 * time.Second
+	defaultPublishTimeout = 5 * time.Second
+)
+
+var ErrDisconnected = errors.New("broker disconnected")
+
+// ReconnectingBroker supervises a Broker produced by dial. Whenever the
+// underlying connection or one of its channels dies it re-dials with
+// backoff, re-declares every exchange, queue and binding seen so far and
+// restores the QoS settings and consumers of every open channel.
+type ReconnectingBroker struct {
+	dial           func() (Broker, error)
+	PublishTimeout time.Duration
+
+	mu        sync.Mutex
+	current   Broker
+	connected chan struct{}
+	topology  []topologyOp
+	declared  map[string]int
+	channels  map[*managedChannel]struct{}
+	closes    []chan *amqp.Error
+	done      chan struct{}
+	closed    bool
+}
+
+type topologyOp struct {
+	id    string
+	apply func(ch Channel) error
+}
+
+func NewReconnectingBroker(dial func() (Broker, error)) (*ReconnectingBroker, error) {
+	b, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	rb := &ReconnectingBroker{
+		dial:           dial,
+		PublishTimeout: defaultPublishTimeout,
+		current:        b,
+		connected:      make(chan struct{}),
+		declared:       map[string]int{},
+		channels:       map[*managedChannel]struct{}{},
+		done:           make(chan struct{}),
+	}
+	close(rb.connected)
+	go rb.supervise(b)
+	return rb, nil
+}
+
+func DialReconnecting(url string) (*ReconnectingBroker, error) {
+	return NewReconnectingBroker(func() (Broker, error) {
+		return DialAMQP(url)
+	})
+}
+
+func (rb *ReconnectingBroker) Channel() (Channel, error) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if rb.closed {
+		return nil, amqp.ErrClosed
+	}
+	mc := &managedChannel{
+		rb:        rb,
+		consumers: map[string]*managedConsumer{},
+	}
+	if rb.current != nil {
+		ch, err := rb.current.Channel()
+		if err != nil {
+			return nil, err
+		}
+		mc.install(ch)
+	}
+	rb.channels[mc] = struct{}{}
+	return mc, nil
+}
+
+func (rb *ReconnectingBroker) NotifyClose(c chan *amqp.Error) chan *amqp.Error {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if rb.closed {
+		close(c)
+	} else {
+		rb.closes = append(rb.closes, c)
+	}
+	return c
+}
+
+func (rb *ReconnectingBroker) Close() error {
+	rb.mu.Lock()
+	if rb.closed {
+		rb.mu.Unlock()
+		return amqp.ErrClosed
+	}
+	rb.closed = true
+	close(rb.done)
+	current := rb.current
+	channels := rb.channels
+	rb.channels = map[*managedChannel]struct{}{}
+	for _, c := range rb.closes {
+		close(c)
+	}
+	rb.closes = nil
+	rb.mu.Unlock()
+
+	for mc := range channels {
+		mc.Close()
+	}
+	if current != nil {
+		return current.Close()
+	}
+	return nil
+}
+
+func (rb *ReconnectingBroker) supervise(b Broker) {
+	for {
+		notify := b.NotifyClose(make(chan *amqp.Error, 1))
+		select {
+		case err := <-notify:
+			log.Printf("Broker connection lost: %v\n", err)
+		case <-rb.done:
+			return
+		}
+		rb.mu.Lock()
+		if rb.closed {
+			rb.mu.Unlock()
+			return
+		}
+		rb.current = nil
+		rb.connected = make(chan struct{})
+		rb.mu.Unlock()
+
+		b = rb.reconnect()
+		if b == nil {
+			return
+		}
+	}
+}
+
+// reconnect dials until it succeeds and the topology has been restored,
+// or the broker is closed, in which case it returns nil.
+func (rb *ReconnectingBroker) reconnect() Broker {
+	delay := minReconnectDelay
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-time.After(delay):
+		case <-rb.done:
+			return nil
+		}
+		delay = min(delay*2, maxReconnectDelay)
+
+		b, err := rb.dial()
+		if err != nil {
+			log.Printf("Reconnect attempt %d failed: %v\n", attempt, err)
+			continue
+		}
+		if err := rb.restore(b); err != nil {
+			log.Printf("Restoring topology failed: %v\n", err)
+			b.Close()
+			continue
+		}
+		log.Printf("Reconnected to broker after %d attempt(s)\n", attempt)
+		return b
+	}
+}
+
+func (rb *ReconnectingBroker) restore(b Broker) error {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if rb.closed {
+		return amqp.ErrClosed
+	}
+	ch, err := b.Channel()
+	if err != nil {
+		return err
+	}
+	for _, op := range rb.topology {
+		if err := op.apply(ch); err != nil {
+			return fmt.Errorf("Re-declaring %s failed: %w", op.id, err)
+		}
+	}
+	ch.Close()
+	for mc := range rb.channels {
+		ch, err := b.Channel()
+		if err != nil {
+			return err
+		}
+		if err := mc.restore(ch); err != nil {
+			return err
+		}
+	}
+	rb.current = b
+	close(rb.connected)
+	return nil
+}
+
+// record remembers a successful declaration so that it is replayed after
+// a reconnect. Re-declaring the same entity replaces the earlier entry.
+func (rb *ReconnectingBroker) record(id string, apply func(ch Channel) error) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	op := topologyOp{id: id, apply: apply}
+	if i, ok := rb.declared[id]; ok {
+		rb.topology[i] = op
+		return
+	}
+	rb.declared[id] = len(rb.topology)
+	rb.topology = append(rb.topology, op)
+}
+
+// forget drops a recorded declaration so that it is no longer replayed.
+func (rb *ReconnectingBroker) forget(id string) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	i, ok := rb.declared[id]
+	if !ok {
+		return
+	}
+	rb.topology = append(rb.topology[:i], rb.topology[i+1:]...)
+	delete(rb.declared, id)
+	for id, j := range rb.declared {
+		if j > i {
+			rb.declared[id] = j - 1
+		}
+	}
+}
+
+// reopen replaces a channel that died while its connection stayed up.
+func (rb *ReconnectingBroker) reopen(mc *managedChannel, dead Channel) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if rb.closed || rb.current == nil {
+		return
+	}
+	ch, err := rb.current.Channel()
+	if err != nil {
+		log.Printf("Reopening channel failed: %v\n", err)
+		return
+	}
+	mc.mu.Lock()
+	stale := mc.ch != dead
+	mc.mu.Unlock()
+	if stale {
+		ch.Close()
+		return
+	}
+	if err := mc.restore(ch); err != nil {
+		log.Printf("Restoring channel failed: %v\n", err)
+	}
+}
+
+// waitConnected blocks until a connection is available.
+func (rb *ReconnectingBroker) waitConnected(ctx context.Context) error {
+	rb.mu.Lock()
+	connected := rb.connected
+	rb.mu.Unlock()
+	select {
+	case <-connected:
+		return nil
+	case <-rb.done:
+		return amqp.ErrClosed
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %w", ErrDisconnected, ctx.Err())
+	}
+}
+
+type managedChannel struct {
+	rb *ReconnectingBroker
+
+	// pubMu serialises publishes so that confirm sequence numbers match
+	// the order in which messages reached the underlying channel.
+	pubMu sync.Mutex
+
+	mu        sync.Mutex
+	ch        Channel
+	session   *confirmSession
+	qos       *qosSettings
+	consumers map[string]*managedConsumer
+	confirm   bool
+	pubSeq    uint64
+	confirms  []chan amqp.Confirmation
+	returns   []chan amqp.Return
+	closes    []chan *amqp.Error
+	closed    bool
+}
+
+// confirmSession maps the delivery tags of one underlying channel onto
+// the sequence numbers the managed channel has handed out.
+type confirmSession struct {
+	base      uint64
+	confirmed uint64
+	done      chan struct{}
+}
+
+type qosSettings struct {
+	prefetchCount int
+	prefetchSize  int
+	global        bool
+}
+
+type managedConsumer struct {
+	queue     string
+	tag       string
+	autoAck   bool
+	exclusive bool
+	noLocal   bool
+	args      amqp.Table
+	srcs      chan (<-chan amqp.Delivery)
+	out       chan amqp.Delivery
+	done      chan struct{}
+}
+
+// install makes ch the live channel and watches it for unexpected closes.
+// mc.mu must be held or mc not yet shared.
+func (mc *managedChannel) install(ch Channel) {
+	mc.ch = ch
+	session := &confirmSession{base: mc.pubSeq, confirmed: mc.pubSeq, done: make(chan struct{})}
+	mc.session = session
+	if mc.confirm {
+		if err := ch.Confirm(false); err != nil {
+			log.Printf("Re-enabling publisher confirms failed: %v\n", err)
+		}
+	}
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, 64))
+	returns := ch.NotifyReturn(make(chan amqp.Return, 64))
+	go mc.relay(session, confirms, returns)
+
+	notify := ch.NotifyClose(make(chan *amqp.Error, 1))
+	go func() {
+		err, ok := <-notify
+		if !ok || err == nil {
+			return
+		}
+		mc.mu.Lock()
+		closed := mc.closed
+		mc.mu.Unlock()
+		if closed {
+			return
+		}
+		log.Printf("Channel closed by broker: %v\n", err)
+		mc.rb.reopen(mc, ch)
+	}()
+}
+
+// relay forwards confirmations and returns from one underlying channel.
+// Returns are always delivered before the confirmation of the same
+// message, and publishes that were never confirmed because the channel
+// died are reported as nacks.
+func (mc *managedChannel) relay(session *confirmSession, confirms chan amqp.Confirmation, returns chan amqp.Return) {
+	defer close(session.done)
+	for {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			mc.emitReturn(r)
+		case c, ok := <-confirms:
+			if !ok {
+				mc.mu.Lock()
+				first, last := session.confirmed+1, mc.pubSeq
+				if mc.session != session {
+					last = session.confirmed
+				}
+				mc.mu.Unlock()
+				for tag := first; tag <= last; tag++ {
+					mc.emitConfirm(amqp.Confirmation{DeliveryTag: tag, Ack: false})
+				}
+				return
+			}
+			for drained := false; !drained && returns != nil; {
+				select {
+				case r, ok := <-returns:
+					if !ok {
+						returns = nil
+						continue
+					}
+					mc.emitReturn(r)
+				default:
+					drained = true
+				}
+			}
+			mc.mu.Lock()
+			c.DeliveryTag += session.base
+			session.confirmed = c.DeliveryTag
+			mc.mu.Unlock()
+			mc.emitConfirm(c)
+		}
+	}
+}
+
+func (mc *managedChannel) emitConfirm(c amqp.Confirmation) {
+	mc.mu.Lock()
+	listeners := mc.confirms
+	mc.mu.Unlock()
+	for _, l := range listeners {
+		l <- c
+	}
+}
+
+func (mc *managedChannel) emitReturn(r amqp.Return) {
+	mc.mu.Lock()
+	listeners := mc.returns
+	mc.mu.Unlock()
+	for _, l := range listeners {
+		l <- r
+	}
+}
+
+func (mc *managedChannel) restore(ch Channel) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.closed {
+		ch.Close()
+		return nil
+	}
+	if mc.qos != nil {
+		if err := ch.Qos(mc.qos.prefetchCount, mc.qos.prefetchSize, mc.qos.global); err != nil {
+			return err
+		}
+	}
+	for _, c := range mc.consumers {
+		src, err := ch.Consume(c.queue, c.tag, c.autoAck, c.exclusive, c.noLocal, false, c.args)
+		if err != nil {
+			return fmt.Errorf("Re-consuming %s failed: %w", c.queue, err)
+		}
+		c.resume(src)
+	}
+	mc.install(ch)
+	return nil
+}
+
+// live returns the current underlying channel, waiting for a reconnect
+// if there is none.
+func (mc *managedChannel) live(ctx context.Context) (Channel, error) {
+	for {
+		mc.mu.Lock()
+		ch, closed := mc.ch, mc.closed
+		mc.mu.Unlock()
+		if closed {
+			return nil, amqp.ErrClosed
+		}
+		if ch != nil && !isClosed(ch) {
+			return ch, nil
+		}
+		if err := mc.rb.waitConnected(ctx); err != nil {
+			return nil, err
+		}
+		mc.mu.Lock()
+		replaced := mc.ch != ch
+		mc.mu.Unlock()
+		if !replaced {
+			select {
+			case <-time.After(minReconnectDelay):
+			case <-ctx.Done():
+				return nil, fmt.Errorf("%w: %w", ErrDisconnected, ctx.Err())
+			}
+		}
+	}
+}
+
+func isClosed(ch Channel) bool {
+	if c, ok := ch.(interface{ IsClosed() bool }); ok {
+		return c.IsClosed()
+	}
+	return false
+}
+
+func (mc *managedChannel) declare(id string, apply func(ch Channel) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), mc.rb.PublishTimeout)
+	defer cancel()
+	ch, err := mc.live(ctx)
+	if err != nil {
+		return err
+	}
+	if err := apply(ch); err != nil {
+		return err
+	}
+	mc.rb.record(id, apply)
+	return nil
+}
+
+func (mc *managedChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	return mc.declare("exchange "+name, func(ch Channel) error {
+		return ch.ExchangeDeclare(name, kind, durable, autoDelete, internal, noWait, args)
+	})
+}
+
+func (mc *managedChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	var queue amqp.Queue
+	err := mc.declare("queue "+name, func(ch Channel) error {
+		q, err := ch.QueueDeclare(name, durable, autoDelete, exclusive, noWait, args)
+		queue = q
+		return err
+	})
+	return queue, err
+}
+
+// Passive declares only inspect the broker, so they are not replayed.
+func (mc *managedChannel) ExchangeDeclarePassive(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	ctx, cancel := context.WithTimeout(context.Background(), mc.rb.PublishTimeout)
+	defer cancel()
+	ch, err := mc.live(ctx)
+	if err != nil {
+		return err
+	}
+	return ch.ExchangeDeclarePassive(name, kind, durable, autoDelete, internal, noWait, args)
+}
+
+func (mc *managedChannel) QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), mc.rb.PublishTimeout)
+	defer cancel()
+	ch, err := mc.live(ctx)
+	if err != nil {
+		return amqp.Queue{}, err
+	}
+	return ch.QueueDeclarePassive(name, durable, autoDelete, exclusive, noWait, args)
+}
+
+// bindingID tells bindings apart by their arguments too, since headers
+// bindings of one queue differ only in those.
+func bindingID(name, key, exchange string, args amqp.Table) string {
+	if len(args) == 0 {
+		return fmt.Sprintf("binding %s -> %s (%s)", exchange, name, key)
+	}
+	return fmt.Sprintf("binding %s -> %s (%s) %v", exchange, name, key, map[string]any(args))
+}
+
+func (mc *managedChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	return mc.declare(bindingID(name, key, exchange, args), func(ch Channel) error {
+		return ch.QueueBind(name, key, exchange, noWait, args)
+	})
+}
+
+// QueueUnbind removes the binding and stops restoring it on reconnect.
+func (mc *managedChannel) QueueUnbind(name, key, exchange string, args amqp.Table) error {
+	ctx, cancel := context.WithTimeout(context.Background(), mc.rb.PublishTimeout)
+	defer cancel()
+	ch, err := mc.live(ctx)
+	if err != nil {
+		return err
+	}
+	if err := ch.QueueUnbind(name, key, exchange, args); err != nil {
+		return err
+	}
+	mc.rb.forget(bindingID(name, key, exchange, args))
+	return nil
+}
+
+func (mc *managedChannel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, mc.rb.PublishTimeout)
+		defer cancel()
+	}
+	mc.pubMu.Lock()
+	defer mc.pubMu.Unlock()
+	ch, err := mc.live(ctx)
+	if err != nil {
+		return err
+	}
+	if err := ch.PublishWithContext(ctx, exchange, key, mandatory, immediate, msg); err != nil {
+		return err
+	}
+	mc.mu.Lock()
+	if mc.confirm {
+		mc.pubSeq++
+	}
+	mc.mu.Unlock()
+	return nil
+}
+
+func (mc *managedChannel) Confirm(noWait bool) error {
+	mc.pubMu.Lock()
+	defer mc.pubMu.Unlock()
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.closed {
+		return amqp.ErrClosed
+	}
+	if mc.confirm {
+		return nil
+	}
+	mc.confirm = true
+	if mc.ch == nil {
+		return nil
+	}
+	mc.session.base = mc.pubSeq
+	mc.session.confirmed = mc.pubSeq
+	return mc.ch.Confirm(noWait)
+}
+
+func (mc *managedChannel) NotifyPublish(c chan amqp.Confirmation) chan amqp.Confirmation {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.closed {
+		close(c)
+	} else {
+		mc.confirms = append(mc.confirms, c)
+	}
+	return c
+}
+
+func (mc *managedChannel) NotifyReturn(c chan amqp.Return) chan amqp.Return {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.closed {
+		close(c)
+	} else {
+		mc.returns = append(mc.returns, c)
+	}
+	return c
+}
+
+func (mc *managedChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	mc.mu.Lock()
+	mc.qos = &qosSettings{prefetchCount: prefetchCount, prefetchSize: prefetchSize, global: global}
+	ch := mc.ch
+	mc.mu.Unlock()
+	if ch == nil {
+		return nil
+	}
+	return ch.Qos(prefetchCount, prefetchSize, global)
+}
+
+func (mc *managedChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.closed {
+		return nil, amqp.ErrClosed
+	}
+	if mc.ch == nil {
+		return nil, ErrDisconnected
+	}
+	if consumer == "" {
+		consumer = uniqueConsumerTag()
+	}
+	if _, ok := mc.consumers[consumer]; ok {
+		return nil, fmt.Errorf("Consumer tag %s already in use", consumer)
+	}
+	src, err := mc.ch.Consume(queue, consumer, autoAck, exclusive, noLocal, noWait, args)
+	if err != nil {
+		return nil, err
+	}
+	c := &managedConsumer{
+		queue:     queue,
+		tag:       consumer,
+		autoAck:   autoAck,
+		exclusive: exclusive,
+		noLocal:   noLocal,
+		args:      args,
+		srcs:      make(chan (<-chan amqp.Delivery), 1),
+		out:       make(chan amqp.Delivery),
+		done:      make(chan struct{}),
+	}
+	c.srcs <- src
+	mc.consumers[consumer] = c
+	go c.forward()
+	return c.out, nil
+}
+
+// resume hands a re-established source to forward. A source that forward
+// has not picked up yet belongs to a dead channel, so it is replaced
+// rather than waited on.
+func (c *managedConsumer) resume(src <-chan amqp.Delivery) {
+	for {
+		select {
+		case c.srcs <- src:
+			return
+		default:
+		}
+		select {
+		case <-c.srcs:
+		default:
+		}
+	}
+}
+
+// forward copies deliveries from whichever underlying consumer is current
+// into the stable out channel until the consumer is cancelled.
+func (c *managedConsumer) forward() {
+	defer close(c.out)
+	for {
+		var src <-chan amqp.Delivery
+		select {
+		case src = <-c.srcs:
+		case <-c.done:
+			return
+		}
+		for d := range src {
+			select {
+			case c.out <- d:
+			case <-c.done:
+				return
+			}
+		}
+	}
+}
+
+func (mc *managedChannel) Get(queue string, autoAck bool) (amqp.Delivery, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), mc.rb.PublishTimeout)
+	defer cancel()
+	ch, err := mc.live(ctx)
+	if err != nil {
+		return amqp.Delivery{}, false, err
+	}
+	return ch.Get(queue, autoAck)
+}
+
+func (mc *managedChannel) QueuePurge(name string, noWait bool) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), mc.rb.PublishTimeout)
+	defer cancel()
+	ch, err := mc.live(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return ch.QueuePurge(name, noWait)
+}
+
+func (mc *managedChannel) Cancel(consumer string, noWait bool) error {
+	mc.mu.Lock()
+	c, ok := mc.consumers[consumer]
+	delete(mc.consumers, consumer)
+	ch := mc.ch
+	mc.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("Consumer %s is unknown", consumer)
+	}
+	close(c.done)
+	if ch == nil {
+		return nil
+	}
+	return ch.Cancel(consumer, noWait)
+}
+
+func (mc *managedChannel) NotifyClose(c chan *amqp.Error) chan *amqp.Error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.closed {
+		close(c)
+	} else {
+		mc.closes = append(mc.closes, c)
+	}
+	return c
+}
+
+func (mc *managedChannel) Close() error {
+	mc.mu.Lock()
+	if mc.closed {
+		mc.mu.Unlock()
+		return amqp.ErrClosed
+	}
+	mc.closed = true
+	ch := mc.ch
+	for _, c := range mc.consumers {
+		close(c.done)
+	}
+	mc.consumers = nil
+	for _, c := range mc.closes {
+		close(c)
+	}
+	mc.closes = nil
+	session := mc.session
+	mc.mu.Unlock()
+
+	var err error
+	if ch != nil {
+		err = ch.Close()
+	}
+	if session != nil {
+		<-session.done
+	}
+	mc.mu.Lock()
+	confirms, returns := mc.confirms, mc.returns
+	mc.confirms, mc.returns = nil, nil
+	mc.mu.Unlock()
+	for _, c := range confirms {
+		close(c)
+	}
+	for _, c := range returns {
+		close(c)
+	}
+	mc.rb.mu.Lock()
+	delete(mc.rb.channels, mc)
+	mc.rb.mu.Unlock()
+	return err
+}
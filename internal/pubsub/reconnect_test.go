@@ -0,0 +1,180 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// memDialer hands out a fresh MemoryBroker on every dial, so whatever
+// the ReconnectingBroker needs after a reconnect has to be re-declared.
+type memDialer struct {
+	mu      sync.Mutex
+	brokers []*MemoryBroker
+}
+
+func (d *memDialer) dial() (Broker, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	b := NewMemoryBroker()
+	d.brokers = append(d.brokers, b)
+	return b, nil
+}
+
+func (d *memDialer) current() *MemoryBroker {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.brokers[len(d.brokers)-1]
+}
+
+func newTestReconnecting(t *testing.T) (*ReconnectingBroker, *memDialer) {
+	t.Helper()
+	d := &memDialer{}
+	rb, err := NewReconnectingBroker(d.dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rb.Close() })
+	return rb, d
+}
+
+// breakChannel closes the live channel behind mc the way a channel
+// exception would, and waits for mc to replace it.
+func breakChannel(t *testing.T, mc *managedChannel) {
+	t.Helper()
+	mc.mu.Lock()
+	dead := mc.ch.(*memChannel)
+	mc.mu.Unlock()
+	b := dead.broker
+	b.mu.Lock()
+	for _, c := range dead.closes {
+		select {
+		case c <- &amqp.Error{Code: amqp.PreconditionFailed, Reason: "test"}:
+		default:
+		}
+	}
+	dead.close()
+	b.mu.Unlock()
+	waitReplaced(t, mc, dead)
+}
+
+func waitReplaced(t *testing.T, mc *managedChannel, dead Channel) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for time.Now().Before(deadline) {
+		mc.mu.Lock()
+		ch := mc.ch
+		mc.mu.Unlock()
+		if ch != dead && ch != nil && !isClosed(ch) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("channel was not restored")
+}
+
+func setUpWork(t *testing.T, rb *ReconnectingBroker) (*managedChannel, <-chan amqp.Delivery) {
+	t.Helper()
+	ch, err := rb.Channel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateExchange(ch, "direct", Direct, Durable); err != nil {
+		t.Fatal(err)
+	}
+	declareQueue(t, ch, "work", nil, [2]string{"direct", "work"})
+	msgs, err := ch.Consume("work", "", false, false, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ch.(*managedChannel), msgs
+}
+
+func publishBody(t *testing.T, ch Channel, body string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	err := ch.PublishWithContext(ctx, "direct", "work", false, false, amqp.Publishing{Body: []byte(body)})
+	if err != nil {
+		t.Fatalf("publishing %q failed: %v", body, err)
+	}
+}
+
+// receiveBody skips deliveries that were left over from dead channels.
+func receiveBody(t *testing.T, msgs <-chan amqp.Delivery, body string) {
+	t.Helper()
+	for {
+		d := receive(t, msgs)
+		if string(d.Body) == body {
+			d.Ack(false)
+			return
+		}
+	}
+}
+
+func TestReconnectingBrokerRestoresAfterConnectionLoss(t *testing.T) {
+	rb, d := newTestReconnecting(t)
+	ch, msgs := setUpWork(t, rb)
+	publishBody(t, ch, "before")
+	receiveBody(t, msgs, "before")
+
+	first := d.current()
+	first.Close()
+	publishBody(t, ch, "after")
+	if d.current() == first {
+		t.Fatal("publish succeeded without a reconnect")
+	}
+	receiveBody(t, msgs, "after")
+
+	// The topology was declared again on the new connection.
+	if _, err := ch.QueueDeclarePassive("work", true, false, false, false, nil); err != nil {
+		t.Errorf("queue was not restored: %v", err)
+	}
+}
+
+func TestReconnectingBrokerRestoresAfterChannelLoss(t *testing.T) {
+	rb, _ := newTestReconnecting(t)
+	ch, msgs := setUpWork(t, rb)
+	breakChannel(t, ch)
+	publishBody(t, ch, "after")
+	receiveBody(t, msgs, "after")
+}
+
+// A consumer that is not being drained must not wedge later restores.
+func TestReconnectingBrokerRestoresUndrainedConsumer(t *testing.T) {
+	rb, _ := newTestReconnecting(t)
+	ch, msgs := setUpWork(t, rb)
+	publishBody(t, ch, "pending")
+	time.Sleep(50 * time.Millisecond)
+
+	breakChannel(t, ch)
+	breakChannel(t, ch)
+	publishBody(t, ch, "after")
+	receiveBody(t, msgs, "after")
+}
+
+func TestReconnectingBrokerConfirmsAfterReconnect(t *testing.T) {
+	rb, d := newTestReconnecting(t)
+	ch, _ := setUpWork(t, rb)
+	p, err := NewConfirmPublisher(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	if err := p.PublishWithContext(ctx, "direct", "work", true, false, amqp.Publishing{}); err != nil {
+		t.Fatalf("publish before the reconnect failed: %v", err)
+	}
+
+	d.current().Close()
+	if err := p.PublishWithContext(ctx, "direct", "work", true, false, amqp.Publishing{}); err != nil {
+		t.Errorf("publish after the reconnect failed: %v", err)
+	}
+	breakChannel(t, ch)
+	if err := p.PublishWithContext(ctx, "direct", "work", true, false, amqp.Publishing{}); err != nil {
+		t.Errorf("publish after the channel was reopened failed: %v", err)
+	}
+}
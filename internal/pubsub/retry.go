@@ -0,0 +1,182 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const retryCountHeader = "x-retry-count"
+
+// jitterBuckets is the number of retry queues a jittered delay is spread
+// over. Each has its own TTL, since RabbitMQ only expires the message at
+// the head of a queue and per-message expirations would queue up behind
+// longer ones.
+const jitterBuckets = 4
+
+// RetryPolicy controls how deliveries settled with Retry are delayed.
+// Attempt n waits BaseDelay*2^(n-1), capped at MaxDelay and shortened by
+// up to Jitter (a fraction between 0 and 1) so retries do not line up.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Jitter      float64
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   time.Second,
+	MaxDelay:    time.Minute,
+	Jitter:      0.2,
+}
+
+// backoff returns the delay of the retry queue used for the given attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// jittered picks one of the delay buckets between delay*(1-Jitter) and
+// delay, rounded to whole milliseconds as queue TTLs are.
+func (p RetryPolicy) jittered(delay time.Duration) time.Duration {
+	if p.Jitter <= 0 {
+		return delay
+	}
+	step := time.Duration(p.Jitter * float64(delay) / jitterBuckets)
+	jittered := delay - time.Duration(rand.Intn(jitterBuckets))*step
+	return max(jittered.Truncate(time.Millisecond), time.Millisecond)
+}
+
+func RetryQueueName(queue string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%dms", queue, delay.Milliseconds())
+}
+
+func RetryCount(headers amqp.Table) int {
+	n, _ := tableInt(headers[retryCountHeader])
+	return int(n)
+}
+
+// retrier parks failed deliveries in per-delay queues. Each retry queue
+// has a TTL and dead-letters back to the origin queue through the default
+// exchange, so the message reappears once its delay has passed.
+type retrier struct {
+	queue  string
+	policy RetryPolicy
+	ch     Channel
+	pub    Publisher
+
+	mu       sync.Mutex
+	declared map[string]bool
+}
+
+// newRetrier declares retry queues on ch and publishes to them with pub,
+// which should wait for the broker's confirmation.
+func newRetrier(queue string, policy RetryPolicy, ch Channel, pub Publisher) *retrier {
+	return &retrier{
+		queue:    queue,
+		policy:   policy,
+		ch:       ch,
+		pub:      pub,
+		declared: map[string]bool{},
+	}
+}
+
+// retry schedules msg for redelivery and reports how the original
+// delivery should be settled. The original is only acked once the retry
+// is safely in its queue.
+func (r *retrier) retry(ctx context.Context, msg amqp.Delivery, lastErr error) AckType {
+	attempt := RetryCount(msg.Headers) + 1
+	if attempt > r.policy.MaxAttempts {
+		log.Printf("Message on %s failed %d times, dead-lettering\n", r.queue, attempt-1)
+		return NackDiscard
+	}
+	delay := r.policy.jittered(r.policy.backoff(attempt))
+	retryQueue, err := r.declare(delay)
+	if err != nil {
+		log.Printf("Retry queue declaration failed: %v\n", err)
+		return NackRequeue
+	}
+	headers := copyTable(msg.Headers)
+	if headers == nil {
+		headers = amqp.Table{}
+	}
+	headers[retryCountHeader] = int64(attempt)
+	if _, ok := headers[OriginalExchangeHeader]; !ok {
+		headers[OriginalExchangeHeader] = msg.Exchange
+		headers[OriginalRoutingKeyHeader] = msg.RoutingKey
+	}
+	if lastErr != nil {
+		headers[LastErrorHeader] = lastErr.Error()
+	}
+	publishing := publishingFromDelivery(msg)
+	publishing.Headers = headers
+	publishing.Expiration = ""
+	err = r.pub.PublishWithContext(ctx, "", retryQueue, false, false, publishing)
+	if err != nil {
+		log.Printf("Parking message in %s failed: %v\n", retryQueue, err)
+		return NackRequeue
+	}
+	log.Printf("Message on %s parked in %s (attempt %d)\n", r.queue, retryQueue, attempt)
+	return Ack
+}
+
+// restoreRoute puts back the exchange and routing key of a retried
+// message, which the retry queue hands back through the default exchange
+// under its own name.
+func restoreRoute(msg amqp.Delivery) amqp.Delivery {
+	if ex, ok := msg.Headers[OriginalExchangeHeader].(string); ok {
+		msg.Exchange = ex
+		msg.RoutingKey, _ = msg.Headers[OriginalRoutingKeyHeader].(string)
+	}
+	return msg
+}
+
+func (r *retrier) declare(delay time.Duration) (string, error) {
+	name := RetryQueueName(r.queue, delay)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.declared[name] {
+		return name, nil
+	}
+	_, err := r.ch.QueueDeclare(name, true, false, false, false, amqp.Table{
+		"x-message-ttl":             delay.Milliseconds(),
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": r.queue,
+	})
+	if err != nil {
+		return "", err
+	}
+	r.declared[name] = true
+	return name, nil
+}
+
+func tableInt(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,93 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestRetryKeepsOriginalRoute(t *testing.T) {
+	b := NewMemoryBroker()
+	ch := newTestChannel(t, b)
+	CreateExchange(ch, "topic", Topic, Durable)
+
+	type route struct{ exchange, key string }
+	routes := make(chan route, 2)
+	attempts := 0
+	_, err := Subscribe(b, "topic", "logs", "game_logs.*", Durable,
+		func(ctx context.Context, d *Delivery[string]) AckType {
+			routes <- route{d.Exchange, d.RoutingKey}
+			attempts++
+			if attempts == 1 {
+				return Retry
+			}
+			return Ack
+		},
+		WithRetry(RetryPolicy{MaxAttempts: 1, BaseDelay: 10 * time.Millisecond, MaxDelay: 10 * time.Millisecond}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := PublishJSON(ch, "topic", "game_logs.alice", "log"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case r := <-routes:
+			if r != (route{"topic", "game_logs.alice"}) {
+				t.Errorf("attempt %d was delivered as %+v", i+1, r)
+			}
+		case <-time.After(testTimeout):
+			t.Fatalf("attempt %d never arrived", i+1)
+		}
+	}
+}
+
+func TestRetryJitterPicksBucketQueues(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Jitter: 0.4}
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 200; i++ {
+		d := policy.jittered(policy.backoff(1))
+		if d < 60*time.Millisecond || d > 100*time.Millisecond {
+			t.Fatalf("jittered delay %v outside [60ms, 100ms]", d)
+		}
+		seen[d] = true
+	}
+	if len(seen) < 2 || len(seen) > jitterBuckets {
+		t.Errorf("jitter used %d delays, want 2 to %d", len(seen), jitterBuckets)
+	}
+}
+
+type failingPublisher struct{ err error }
+
+func (p failingPublisher) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	return p.err
+}
+
+// The original delivery is only acked once the retry was confirmed.
+func TestRetryRequeuesUnconfirmedRepublish(t *testing.T) {
+	ch := newTestChannel(t, NewMemoryBroker())
+	r := newRetrier("logs", RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Second}, ch, failingPublisher{ErrNacked})
+	got := r.retry(context.Background(), amqp.Delivery{Body: []byte("log")}, nil)
+	if got != NackRequeue {
+		t.Errorf("unconfirmed retry settled as %v, want NackRequeue", got)
+	}
+
+	p, err := NewConfirmPublisher(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = newRetrier("logs", RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Second}, ch, p)
+	if got := r.retry(context.Background(), amqp.Delivery{Body: []byte("log")}, nil); got != Ack {
+		t.Fatalf("confirmed retry settled as %v, want Ack", got)
+	}
+	d, ok, err := ch.Get(RetryQueueName("logs", time.Second), true)
+	if err != nil || !ok {
+		t.Fatalf("retry queue is empty: %v", err)
+	}
+	if d.Expiration != "" {
+		t.Errorf("retry carries expiration %q, want the queue TTL only", d.Expiration)
+	}
+}
@@ -0,0 +1,283 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DirectReplyTo is RabbitMQ's pseudo-queue for replies that are delivered
+// straight to the requesting channel.
+const DirectReplyTo = "amq.rabbitmq.reply-to"
+
+const (
+	StatusHeader = "x-status"
+	ErrorHeader  = "x-error"
+)
+
+const (
+	StatusOK          = 200
+	StatusBadRequest  = 400
+	StatusNotFound    = 404
+	StatusConflict    = 409
+	StatusUnsupported = 415
+	StatusInternal    = 500
+	StatusUnavailable = 503
+)
+
+const DefaultCallTimeout = 5 * time.Second
+
+// RPCError is an error response from a Serve handler.
+type RPCError struct {
+	Code    int
+	Message string
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+func NewRPCError(code int, format string, args ...any) *RPCError {
+	return &RPCError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// RPCHandler answers a request. Returning an *RPCError sends its code to
+// the caller; any other error is reported as StatusInternal.
+type RPCHandler[Req, Resp any] func(ctx context.Context, req Req) (Resp, error)
+
+type rpcReply struct {
+	msg amqp.Delivery
+	err error
+}
+
+// RPCClient sends requests with Call and waits for replies on a channel
+// consuming from DirectReplyTo.
+type RPCClient struct {
+	ch Channel
+	// Timeout bounds calls whose context has no earlier deadline.
+	Timeout time.Duration
+	// Codec encodes requests. Servers answer in the same content type.
+	Codec Codec
+	// Codecs decodes replies.
+	Codecs *CodecRegistry
+
+	mu      sync.Mutex
+	pending map[string]chan rpcReply
+	closed  bool
+	done    chan struct{}
+}
+
+func NewRPCClient(b Broker) (*RPCClient, error) {
+	ch, err := b.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("Channel creation failed: %w", err)
+	}
+	replies, err := ch.Consume(DirectReplyTo, uniqueConsumerTag(), true, false, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("Consuming replies failed: %w", err)
+	}
+	c := &RPCClient{
+		ch:      ch,
+		Timeout: DefaultCallTimeout,
+		Codec:   JSONCodec,
+		Codecs:  DefaultCodecs,
+		pending: map[string]chan rpcReply{},
+		done:    make(chan struct{}),
+	}
+	returns := ch.NotifyReturn(make(chan amqp.Return, 16))
+	go c.listen(replies, returns)
+	return c, nil
+}
+
+func (c *RPCClient) Close() error {
+	err := c.ch.Close()
+	<-c.done
+	return err
+}
+
+func (c *RPCClient) listen(replies <-chan amqp.Delivery, returns chan amqp.Return) {
+	defer close(c.done)
+	for {
+		select {
+		case msg, ok := <-replies:
+			if !ok {
+				c.failPending(amqp.ErrClosed)
+				return
+			}
+			c.resolve(msg.CorrelationId, rpcReply{msg: msg})
+		case r, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			c.resolve(r.CorrelationId, rpcReply{err: &UnroutableError{
+				Exchange:  r.Exchange,
+				Key:       r.RoutingKey,
+				ReplyCode: r.ReplyCode,
+				ReplyText: r.ReplyText,
+			}})
+		}
+	}
+}
+
+func (c *RPCClient) register(id string) (chan rpcReply, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, amqp.ErrClosed
+	}
+	reply := make(chan rpcReply, 1)
+	c.pending[id] = reply
+	return reply, nil
+}
+
+func (c *RPCClient) unregister(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, id)
+}
+
+func (c *RPCClient) resolve(id string, r rpcReply) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	reply, ok := c.pending[id]
+	if !ok {
+		// The caller gave up already.
+		return
+	}
+	delete(c.pending, id)
+	reply <- r
+}
+
+func (c *RPCClient) failPending(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for id, reply := range c.pending {
+		reply <- rpcReply{err: err}
+		delete(c.pending, id)
+	}
+}
+
+// Call publishes req with the client's codec and waits for the reply. It fails with an
+// *RPCError if the server answered with an error, an *UnroutableError if
+// no server queue is bound to key, or the context error on timeout.
+func Call[Req, Resp any](ctx context.Context, c *RPCClient, exchange, key string, req Req) (Resp, error) {
+	var resp Resp
+	body, err := c.Codec.Marshal(req)
+	if err != nil {
+		return resp, fmt.Errorf("Encoding request failed: %w", err)
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCallTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	// A call starts its own correlation so that the reply, which is
+	// stamped as caused by the request, carries the call's ID back.
+	env := NewEnvelope(ctx, req)
+	env.CorrelationID = env.MessageID
+	msg := amqp.Publishing{
+		ContentType: contentTypeOf(c.Codec, req),
+		ReplyTo:     DirectReplyTo,
+		// Nobody is waiting for an answer after the deadline.
+		Expiration: strconv.FormatInt(max(time.Until(deadline).Milliseconds(), 1), 10),
+		Body:       body,
+	}
+	env.Apply(&msg)
+	reply, err := c.register(env.MessageID)
+	if err != nil {
+		return resp, err
+	}
+	defer c.unregister(env.MessageID)
+	err = c.ch.PublishWithContext(ctx, exchange, key, true, false, msg)
+	if err != nil {
+		return resp, fmt.Errorf("Publishing request failed: %w", err)
+	}
+
+	select {
+	case r := <-reply:
+		if r.err != nil {
+			return resp, r.err
+		}
+		status, _ := tableInt(r.msg.Headers[StatusHeader])
+		if status != StatusOK {
+			message, _ := r.msg.Headers[ErrorHeader].(string)
+			return resp, &RPCError{Code: int(status), Message: message}
+		}
+		resp, err = Decode[Resp](c.Codecs, r.msg.ContentType, r.msg.Body)
+		if err != nil {
+			return resp, fmt.Errorf("Decoding response failed: %w", err)
+		}
+		return resp, nil
+	case <-ctx.Done():
+		return resp, fmt.Errorf("Call to %s with key %s failed: %w", exchange, key, ctx.Err())
+	}
+}
+
+// Serve answers requests arriving on queueName and replies in the
+// request's content type. Requests that cannot be decoded get a
+// StatusBadRequest or StatusUnsupported reply without reaching the handler.
+func Serve[Req, Resp any](b Broker, exchange, queueName, key string, simpleQueueType int, handler RPCHandler[Req, Resp], opts ...SubscribeOption) (*Subscription, error) {
+	cfg := newSubscribeConfig(opts)
+	raw := func(msg amqp.Delivery) ([]byte, error) {
+		return msg.Body, nil
+	}
+	return subscribe(b, exchange, queueName, key, simpleQueueType, func(ctx context.Context, d *Delivery[[]byte]) AckType {
+		if d.ReplyTo == "" {
+			d.SetError(errors.New("request has no reply-to address"))
+			return NackDiscard
+		}
+		var resp Resp
+		codec, err := cfg.codecs.Lookup(d.ContentType)
+		if err != nil {
+			codec = JSONCodec
+			err = NewRPCError(StatusUnsupported, "%v", err)
+		} else {
+			var req Req
+			err = codec.Unmarshal(d.Body, &req)
+			if err != nil {
+				err = NewRPCError(StatusBadRequest, "decoding request: %v", err)
+			} else {
+				resp, err = handler(ctx, req)
+			}
+		}
+		err = reply(ctx, d, codec, resp, err)
+		if err != nil {
+			// The caller times out; requeueing would answer too late.
+			log.Printf("Replying to %s failed: %v\n", d.ReplyTo, err)
+		}
+		return Ack
+	}, raw, cfg)
+}
+
+func reply[Resp any](ctx context.Context, d *Delivery[[]byte], codec Codec, resp Resp, handlerErr error) error {
+	msg := amqp.Publishing{
+		ContentType: contentTypeOf(codec, resp),
+		Headers:     amqp.Table{StatusHeader: int64(StatusOK)},
+	}
+	NewEnvelope(ContextWithEnvelope(ctx, d.Envelope), resp).Apply(&msg)
+	if handlerErr == nil {
+		msg.Body, handlerErr = codec.Marshal(resp)
+	}
+	if handlerErr != nil {
+		var rpcErr *RPCError
+		if !errors.As(handlerErr, &rpcErr) {
+			rpcErr = &RPCError{Code: StatusInternal, Message: handlerErr.Error()}
+		}
+		msg.Headers[StatusHeader] = int64(rpcErr.Code)
+		msg.Headers[ErrorHeader] = rpcErr.Message
+		msg.Body = nil
+	}
+	return d.PublishWithContext(ctx, "", d.ReplyTo, false, false, msg)
+}
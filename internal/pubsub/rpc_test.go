@@ -0,0 +1,88 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestRPC(t *testing.T) (*MemoryBroker, Channel, *RPCClient) {
+	t.Helper()
+	b := NewMemoryBroker()
+	ch := newTestChannel(t, b)
+	CreateExchange(ch, "direct", Direct, Durable)
+	c, err := NewRPCClient(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return b, ch, c
+}
+
+func TestCallRoundTrip(t *testing.T) {
+	b, _, c := newTestRPC(t)
+	sub, err := Serve(b, "direct", "arbiter", "arbiter", Transient,
+		func(ctx context.Context, req int) (int, error) {
+			if req < 0 {
+				return 0, NewRPCError(StatusBadRequest, "negative: %d", req)
+			}
+			return req * 2, nil
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close(context.Background())
+
+	got, err := Call[int, int](context.Background(), c, "direct", "arbiter", 21)
+	if err != nil || got != 42 {
+		t.Errorf("Call(21) = %d, %v, want 42", got, err)
+	}
+	_, err = Call[int, int](context.Background(), c, "direct", "arbiter", -1)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != StatusBadRequest {
+		t.Errorf("Call(-1) returned %v, want a StatusBadRequest *RPCError", err)
+	}
+}
+
+func TestCallWithoutServerIsUnroutable(t *testing.T) {
+	_, _, c := newTestRPC(t)
+	_, err := Call[int, int](context.Background(), c, "direct", "nobody", 1)
+	var unroutable *UnroutableError
+	if !errors.As(err, &unroutable) {
+		t.Errorf("call without a server returned %v, want an *UnroutableError", err)
+	}
+}
+
+// A request that reaches a queue but is never answered times out and
+// leaves nothing behind in the client.
+func TestCallTimesOutWithoutReply(t *testing.T) {
+	_, ch, c := newTestRPC(t)
+	declareQueue(t, ch, "arbiter", nil, [2]string{"direct", "arbiter"})
+	c.Timeout = 20 * time.Millisecond
+
+	start := time.Now()
+	_, err := Call[int, int](context.Background(), c, "direct", "arbiter", 1)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unanswered call returned %v, want a deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > testTimeout/2 {
+		t.Errorf("call gave up after %v, want about %v", elapsed, c.Timeout)
+	}
+	c.mu.Lock()
+	pending := len(c.pending)
+	c.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("%d calls still pending after the timeout", pending)
+	}
+
+	// The request expires with the call, so a late server does not answer it.
+	d, ok, err := ch.Get("arbiter", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Errorf("request %s outlived its call", d.MessageId)
+	}
+}
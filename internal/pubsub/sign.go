@@ -0,0 +1,264 @@
+package pubsub
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	SignerHeader    = "x-signer"
+	SignatureHeader = "x-signature"
+)
+
+var (
+	ErrUnsigned     = errors.New("message is not signed")
+	ErrBadSignature = errors.New("message signature does not match")
+	ErrUnknownKey   = errors.New("no key for signer")
+)
+
+// KeyStore looks up the signing key of a player or service.
+type KeyStore interface {
+	Key(signer string) ([]byte, error)
+}
+
+// signedHeaders are the envelope headers covered by the signature, in
+// the order they are fed to the MAC.
+var signedHeaders = []string{SchemaVersionHeader, CausationIDHeader}
+
+// signature is an HMAC-SHA256 over the body and the properties that say
+// who sent what: signer, message ID, type, content type, timestamp and
+// the rest of the envelope. Routing keys are left out because retries
+// and replays change them.
+func signature(key []byte, signer string, msg amqp.Publishing) string {
+	mac := hmac.New(sha256.New, key)
+	fields := []string{
+		signer,
+		msg.MessageId,
+		msg.Type,
+		msg.ContentType,
+		strconv.FormatInt(msg.Timestamp.Unix(), 10),
+		msg.CorrelationId,
+		msg.AppId,
+	}
+	for _, name := range signedHeaders {
+		fields = append(fields, signedHeader(msg.Headers, name))
+	}
+	for _, field := range fields {
+		mac.Write([]byte(field))
+		mac.Write([]byte{0})
+	}
+	mac.Write(msg.Body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedHeader encodes a header for the MAC so that a missing header
+// differs from any value, and integers of any width sign alike.
+func signedHeader(headers amqp.Table, name string) string {
+	v, ok := headers[name]
+	if !ok {
+		return "-"
+	}
+	if n, ok := tableInt(v); ok {
+		return "=" + strconv.FormatInt(n, 10)
+	}
+	return "=" + fmt.Sprint(v)
+}
+
+// Signer is a Publisher that signs every message with its key before
+// handing it to the next Publisher.
+type Signer struct {
+	next Publisher
+	id   string
+	key  []byte
+}
+
+func NewSigner(next Publisher, id string, key []byte) *Signer {
+	return &Signer{next: next, id: id, key: key}
+}
+
+func (s *Signer) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	msg.Headers = copyTable(msg.Headers)
+	if msg.Headers == nil {
+		msg.Headers = amqp.Table{}
+	}
+	msg.Headers[SignerHeader] = s.id
+	msg.Headers[SignatureHeader] = signature(s.key, s.id, msg)
+	return s.next.PublishWithContext(ctx, exchange, key, mandatory, immediate, msg)
+}
+
+// VerifySignature checks a delivery's signature and returns its signer.
+func VerifySignature(keys KeyStore, d amqp.Delivery) (string, error) {
+	signer, _ := d.Headers[SignerHeader].(string)
+	sig, _ := d.Headers[SignatureHeader].(string)
+	if signer == "" || sig == "" {
+		return "", ErrUnsigned
+	}
+	key, err := keys.Key(signer)
+	if err != nil {
+		return signer, err
+	}
+	want := signature(key, signer, publishingFromDelivery(d))
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		return signer, ErrBadSignature
+	}
+	return signer, nil
+}
+
+type signerKey struct{}
+
+// SignerFromContext returns the verified signer of the message being
+// handled, so handlers can check it against the player a message claims
+// to come from.
+func SignerFromContext(ctx context.Context) (string, bool) {
+	signer, ok := ctx.Value(signerKey{}).(string)
+	return signer, ok
+}
+
+// Verify passes on only messages with a valid signature. Unsigned and
+// forged messages are settled with onInvalid: NackDiscard quarantines
+// them in the dead letter queue, Ack drops them.
+func Verify(keys KeyStore, onInvalid AckType) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, m *Message) AckType {
+			signer, err := VerifySignature(keys, m.Delivery)
+			if err != nil {
+				m.Err = fmt.Errorf("rejecting message from %q: %w", signer, err)
+				return onInvalid
+			}
+			return next(context.WithValue(ctx, signerKey{}, signer), m)
+		}
+	}
+}
+
+// FileKeyStore keeps hex-encoded keys in a JSON file mapping signers to
+// keys. Keys missing from memory are looked up in the file again, so
+// players provisioned by another process are picked up.
+type FileKeyStore struct {
+	path string
+
+	mu   sync.Mutex
+	keys map[string]string
+}
+
+func NewFileKeyStore(path string) (*FileKeyStore, error) {
+	s := &FileKeyStore{path: path, keys: map[string]string{}}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the file. The lock must be held.
+func (s *FileKeyStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Reading key store failed: %w", err)
+	}
+	keys := map[string]string{}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("Reading key store failed: %w", err)
+	}
+	s.keys = keys
+	return nil
+}
+
+func (s *FileKeyStore) Key(signer string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	encoded, ok := s.keys[signer]
+	if !ok {
+		if err := s.load(); err != nil {
+			return nil, err
+		}
+		encoded, ok = s.keys[signer]
+	}
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", signer, ErrUnknownKey)
+	}
+	return hex.DecodeString(encoded)
+}
+
+// Provision returns the signer's key, generating and saving a new one if
+// it has none. An existing key is never replaced. Only whoever owns the
+// store should provision keys, since a key is all it takes to sign as
+// its signer.
+func (s *FileKeyStore) Provision(signer string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if encoded, ok := s.keys[signer]; ok {
+		return hex.DecodeString(encoded)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	s.keys[signer] = hex.EncodeToString(key)
+	data, err := json.MarshalIndent(s.keys, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return nil, fmt.Errorf("Writing key store failed: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return nil, fmt.Errorf("Writing key store failed: %w", err)
+	}
+	return key, nil
+}
+
+// ReadKeyFile reads a single key written by WriteKeyFile.
+func ReadKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Reading key failed: %w", err)
+	}
+	return hex.DecodeString(strings.TrimSpace(string(data)))
+}
+
+// WriteKeyFile saves a single key, readable only by its owner, to hand
+// out to a player.
+func WriteKeyFile(path string, key []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return fmt.Errorf("Writing key failed: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("Writing key failed: %w", err)
+	}
+	return nil
+}
+
+// Signers lists everyone with a key.
+func (s *FileKeyStore) Signers() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	signers := make([]string, 0, len(s.keys))
+	for signer := range s.keys {
+		signers = append(signers, signer)
+	}
+	slices.Sort(signers)
+	return signers, nil
+}
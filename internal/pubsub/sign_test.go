@@ -0,0 +1,95 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type capturePublisher struct {
+	msg amqp.Publishing
+}
+
+func (p *capturePublisher) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	p.msg = msg
+	return nil
+}
+
+type signCase struct {
+	name string
+	d    amqp.Delivery
+	want error
+}
+
+func TestVerifySignature(t *testing.T) {
+	dir := t.TempDir()
+	keys, err := NewFileKeyStore(filepath.Join(dir, "server.keys"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, err := keys.Provision("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Players only get their own key, handed out as a key file.
+	keyFile := filepath.Join(dir, "alice.key")
+	if err := WriteKeyFile(keyFile, alice); err != nil {
+		t.Fatal(err)
+	}
+	issued, err := ReadKeyFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(signer string, key []byte) amqp.Delivery {
+		var out capturePublisher
+		if err := Publish(NewSigner(&out, signer, key), JSONCodec, "ex", "key", "hello"); err != nil {
+			t.Fatal(err)
+		}
+		msg := out.msg
+		return amqp.Delivery{Headers: msg.Headers, ContentType: msg.ContentType, MessageId: msg.MessageId,
+			Type: msg.Type, Timestamp: msg.Timestamp, CorrelationId: msg.CorrelationId, AppId: msg.AppId,
+			Body: msg.Body}
+	}
+	tampered := sign("alice", issued)
+	tampered.Body = []byte(`"goodbye"`)
+	unsigned := sign("alice", issued)
+	unsigned.Headers = amqp.Table{}
+
+	tests := []signCase{
+		{"signed", sign("alice", issued), nil},
+		{"unsigned", unsigned, ErrUnsigned},
+		{"wrong key", sign("alice", []byte("guess")), ErrBadSignature},
+		{"tampered", tampered, ErrBadSignature},
+		{"unknown signer", sign("mallory", issued), ErrUnknownKey},
+	}
+	// Every part of the envelope is covered, down to a header being
+	// added or dropped.
+	for name, tamper := range map[string]func(d *amqp.Delivery){
+		"correlation id": func(d *amqp.Delivery) { d.CorrelationId = "other" },
+		"producer":       func(d *amqp.Delivery) { d.AppId = "peril-server" },
+		"schema version": func(d *amqp.Delivery) { d.Headers[SchemaVersionHeader] = int64(2) },
+		"no version":     func(d *amqp.Delivery) { delete(d.Headers, SchemaVersionHeader) },
+		"causation id":   func(d *amqp.Delivery) { d.Headers[CausationIDHeader] = "other" },
+	} {
+		d := sign("alice", issued)
+		tamper(&d)
+		tests = append(tests, signCase{"tampered " + name, d, ErrBadSignature})
+	}
+	// The broker may hand integers back at another width.
+	widened := sign("alice", issued)
+	widened.Headers[SchemaVersionHeader] = int32(1)
+	tests = append(tests, signCase{"widened version", widened, nil})
+	for _, tt := range tests {
+		signer, err := VerifySignature(keys, tt.d)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+		if tt.want == nil && signer != "alice" {
+			t.Errorf("%s: signer is %q", tt.name, signer)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const DefaultPrefetch = 10
+
+type SubscribeOption func(*subscribeConfig)
+
+type subscribeConfig struct {
+	retry           RetryPolicy
+	poisonThreshold int
+	middleware      []Middleware
+	prefetch        int
+	globalQos       bool
+	workers         int
+	orderByKey      bool
+	existingQueue   bool
+	bindArgs        amqp.Table
+	bindings        []Binding
+	codecs          *CodecRegistry
+	upcasters       *UpcasterRegistry
+}
+
+func newSubscribeConfig(opts []SubscribeOption) subscribeConfig {
+	cfg := subscribeConfig{
+		retry:           DefaultRetryPolicy,
+		poisonThreshold: DefaultPoisonThreshold,
+		prefetch:        DefaultPrefetch,
+		globalQos:       true,
+		workers:         1,
+		codecs:          DefaultCodecs,
+		upcasters:       DefaultUpcasters,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithRetry sets the policy applied when the handler returns Retry.
+func WithRetry(policy RetryPolicy) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.retry = policy
+	}
+}
+
+// WithPoisonThreshold parks messages in the queue's parking lot once they
+// have been delivered n times. Zero disables poison detection.
+func WithPoisonThreshold(n int) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.poisonThreshold = n
+	}
+}
+
+// WithMiddleware wraps this subscription's handler. It runs inside any
+// middleware registered on a Subscriber.
+func WithMiddleware(mws ...Middleware) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.middleware = append(cfg.middleware, mws...)
+	}
+}
+
+// WithPrefetch limits how many unacked messages the broker hands to the
+// subscription at once. It should be at least the number of workers.
+func WithPrefetch(n int) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.prefetch = n
+	}
+}
+
+// WithGlobalQos chooses whether the prefetch limit applies to the whole
+// channel or to each consumer on it.
+func WithGlobalQos(global bool) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.globalQos = global
+	}
+}
+
+// WithWorkers runs n handlers concurrently. Messages are acked as each
+// handler finishes, not in delivery order.
+func WithWorkers(n int) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.workers = n
+	}
+}
+
+// WithKeyOrdering keeps messages with the same routing key in order while
+// still spreading different keys across workers.
+func WithKeyOrdering() SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.orderByKey = true
+	}
+}
+
+// WithExistingQueue consumes a queue that was provisioned elsewhere, for
+// example by the topology package, instead of declaring and binding it.
+func WithExistingQueue() SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.existingQueue = true
+	}
+}
+
+// WithBindings binds the queue to more exchanges or keys besides the one
+// passed to Subscribe. Pass an empty exchange to Subscribe to use only
+// these.
+func WithBindings(bindings ...Binding) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.bindings = append(cfg.bindings, bindings...)
+	}
+}
+
+// WithCodecs decodes messages with r instead of DefaultCodecs.
+func WithCodecs(r *CodecRegistry) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.codecs = r
+	}
+}
+
+// WithUpcasters upcasts old schema versions with r instead of
+// DefaultUpcasters.
+func WithUpcasters(r *UpcasterRegistry) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.upcasters = r
+	}
+}
+
+// Binding routes messages from an exchange to a subscription's queue.
+// Args carry the match of a headers exchange binding.
+type Binding struct {
+	Exchange string
+	Key      string
+	Args     amqp.Table
+}
+
+func (b Binding) String() string {
+	if len(b.Args) > 0 {
+		return fmt.Sprintf("%s %v", b.Exchange, map[string]any(b.Args))
+	}
+	return b.Exchange + " -> " + b.Key
+}
+
+func (b Binding) equal(o Binding) bool {
+	return b.Exchange == o.Exchange && b.Key == o.Key && equalBindArgs(b.Args, o.Args)
+}
+
+// Subscription is a running consumer started by Subscribe.
+type Subscription struct {
+	queue       string
+	consumerTag string
+	broker      Broker
+	ch          Channel
+	pubCh       Channel
+	cancel      context.CancelFunc
+	done        chan struct{}
+
+	bindMu   sync.Mutex
+	bindings []Binding
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func (s *Subscription) Queue() string {
+	return s.queue
+}
+
+// Bindings returns the bindings made through this subscription. Bindings
+// of a queue provisioned elsewhere are not included.
+func (s *Subscription) Bindings() []Binding {
+	s.bindMu.Lock()
+	defer s.bindMu.Unlock()
+	return slices.Clone(s.bindings)
+}
+
+// Bind adds a binding to the running subscription's queue.
+func (s *Subscription) Bind(bnd Binding) error {
+	s.bindMu.Lock()
+	defer s.bindMu.Unlock()
+	err := s.onChannel(func(ch Channel) error {
+		return ch.QueueBind(s.queue, bnd.Key, bnd.Exchange, false, bnd.Args)
+	})
+	if err != nil {
+		return fmt.Errorf("Binding %s to %s failed: %w", s.queue, bnd, err)
+	}
+	if !slices.ContainsFunc(s.bindings, bnd.equal) {
+		s.bindings = append(s.bindings, bnd)
+	}
+	return nil
+}
+
+// Unbind removes a binding from the running subscription's queue.
+// Messages already routed to the queue are still delivered.
+func (s *Subscription) Unbind(bnd Binding) error {
+	s.bindMu.Lock()
+	defer s.bindMu.Unlock()
+	err := s.onChannel(func(ch Channel) error {
+		return ch.QueueUnbind(s.queue, bnd.Key, bnd.Exchange, bnd.Args)
+	})
+	if err != nil {
+		return fmt.Errorf("Unbinding %s from %s failed: %w", s.queue, bnd, err)
+	}
+	s.bindings = slices.DeleteFunc(s.bindings, bnd.equal)
+	return nil
+}
+
+// onChannel runs fn on a short-lived channel. A failed bind closes the
+// channel it was sent on, which must not be the consumer's.
+func (s *Subscription) onChannel(fn func(ch Channel) error) error {
+	ch, err := s.broker.Channel()
+	if err != nil {
+		return fmt.Errorf("Channel creation failed: %w", err)
+	}
+	defer ch.Close()
+	return fn(ch)
+}
+
+// Done is closed once the consumer has stopped and every in-flight
+// handler has returned.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close cancels the consumer, waits for in-flight handlers to finish and
+// settle their messages, then releases the channels. If ctx expires first
+// the handlers' context is cancelled and unsettled messages are requeued
+// by the broker when the channel closes.
+func (s *Subscription) Close(ctx context.Context) error {
+	s.closeOnce.Do(func() {
+		cancelErr := s.ch.Cancel(s.consumerTag, false)
+		select {
+		case <-s.done:
+		case <-ctx.Done():
+			s.closeErr = ctx.Err()
+		}
+		s.cancel()
+		s.closeErr = errors.Join(s.closeErr, cancelErr, s.ch.Close(), s.pubCh.Close())
+	})
+	return s.closeErr
+}
@@ -0,0 +1,56 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSubscriptionBindAndUnbind(t *testing.T) {
+	b := NewMemoryBroker()
+	ch := newTestChannel(t, b)
+	CreateExchange(ch, "topic", Topic, Durable)
+
+	got := make(chan string, 4)
+	sub, err := Subscribe(b, "topic", "moves", "army_moves.alice", Durable,
+		func(ctx context.Context, d *Delivery[string]) AckType {
+			got <- d.Body
+			return Ack
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close(context.Background())
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case body := <-got:
+			if body != want {
+				t.Errorf("got %q, want %q", body, want)
+			}
+		case <-time.After(testTimeout):
+			t.Fatalf("%q never arrived", want)
+		}
+	}
+
+	if err := sub.Bind(Binding{Exchange: "missing", Key: "#"}); err == nil {
+		t.Error("binding to a missing exchange succeeded")
+	}
+	bob := Binding{Exchange: "topic", Key: "army_moves.bob"}
+	if err := sub.Bind(bob); err != nil {
+		t.Fatal(err)
+	}
+	PublishJSON(ch, "topic", "army_moves.bob", "bob moved")
+	expect("bob moved")
+
+	if err := sub.Unbind(bob); err != nil {
+		t.Fatal(err)
+	}
+	PublishJSON(ch, "topic", "army_moves.bob", "bob moved again")
+	PublishJSON(ch, "topic", "army_moves.alice", "alice moved")
+	expect("alice moved")
+	if n := len(sub.Bindings()); n != 1 {
+		t.Errorf("subscription has %d bindings, want 1", n)
+	}
+}
@@ -0,0 +1,93 @@
+package pubsub
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+type upcastStep struct {
+	decode func(codecs *CodecRegistry, contentType string, data []byte) (any, error)
+	apply  func(old any) any
+}
+
+// UpcasterRegistry turns payloads of older schema versions into the
+// current Go type on consume.
+type UpcasterRegistry struct {
+	mu    sync.RWMutex
+	steps map[string]map[int]upcastStep
+}
+
+func NewUpcasterRegistry() *UpcasterRegistry {
+	return &UpcasterRegistry{steps: map[string]map[int]upcastStep{}}
+}
+
+// DefaultUpcasters is used by Subscribe unless WithUpcasters says otherwise.
+var DefaultUpcasters = NewUpcasterRegistry()
+
+// RegisterUpcaster upcasts messages of type typeName from version from to
+// from+1. Old is the Go type the from version decodes into; New is the
+// type of the next version, which is the consumer's type for the last
+// step of a chain.
+func RegisterUpcaster[Old, New any](r *UpcasterRegistry, typeName string, from int, fn func(Old) New) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.steps[typeName] == nil {
+		r.steps[typeName] = map[int]upcastStep{}
+	}
+	r.steps[typeName][from] = upcastStep{
+		decode: func(codecs *CodecRegistry, contentType string, data []byte) (any, error) {
+			return Decode[Old](codecs, contentType, data)
+		},
+		apply: func(old any) any {
+			return fn(old.(Old))
+		},
+	}
+}
+
+// upcast decodes a version payload and runs it through the registered
+// steps up to the current version of T.
+func upcast[T any](r *UpcasterRegistry, codecs *CodecRegistry, env Envelope, contentType string, data []byte) (T, error) {
+	var out T
+	typeName := env.Type
+	if typeName == "" {
+		typeName = TypeName(out)
+	}
+	current := schemaVersion(out)
+
+	r.mu.RLock()
+	steps := r.steps[typeName]
+	r.mu.RUnlock()
+	first, ok := steps[env.SchemaVersion]
+	if !ok {
+		return out, fmt.Errorf("no upcaster for %s version %d", typeName, env.SchemaVersion)
+	}
+	val, err := first.decode(codecs, contentType, data)
+	if err != nil {
+		return out, err
+	}
+	for version := env.SchemaVersion; version < current; version++ {
+		step, ok := steps[version]
+		if !ok {
+			return out, fmt.Errorf("no upcaster for %s version %d", typeName, version)
+		}
+		val = step.apply(val)
+	}
+	out, ok = val.(T)
+	if !ok {
+		return out, fmt.Errorf("upcasting %s to version %d produced %s, not %s",
+			typeName, current, reflect.TypeOf(val), reflect.TypeFor[T]())
+	}
+	return out, nil
+}
+
+// decodeVersioned decodes msg as a T, upcasting payloads written with an
+// older schema version. Newer versions are decoded as they are and rely
+// on the codec ignoring unknown fields.
+func decodeVersioned[T any](codecs *CodecRegistry, upcasters *UpcasterRegistry, contentType string, env Envelope, data []byte) (T, error) {
+	var zero T
+	if env.SchemaVersion >= schemaVersion(zero) {
+		return Decode[T](codecs, contentType, data)
+	}
+	return upcast[T](upcasters, codecs, env, contentType, data)
+}
@@ -0,0 +1,58 @@
+package pubsub
+
+import (
+	"hash/fnv"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// runWorkers feeds deliveries to n goroutines running process and returns
+// once msgs is closed and every worker has finished. Each delivery is acked
+// on its own, so workers settle in whatever order they complete.
+//
+// With byKey set, deliveries with the same routing key always go to the
+// same worker and are therefore handled in the order they arrived. Retried
+// deliveries are ordered by the key they were first published with.
+func runWorkers(msgs <-chan amqp.Delivery, n int, byKey bool, process func(amqp.Delivery)) {
+	if n <= 1 {
+		for msg := range msgs {
+			process(msg)
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	work := func(q <-chan amqp.Delivery) {
+		defer wg.Done()
+		for msg := range q {
+			process(msg)
+		}
+	}
+	if !byKey {
+		wg.Add(n)
+		for i := 0; i < n; i++ {
+			go work(msgs)
+		}
+		wg.Wait()
+		return
+	}
+	shards := make([]chan amqp.Delivery, n)
+	wg.Add(n)
+	for i := range shards {
+		shards[i] = make(chan amqp.Delivery)
+		go work(shards[i])
+	}
+	for msg := range msgs {
+		shards[keyShard(restoreRoute(msg).RoutingKey, n)] <- msg
+	}
+	for _, shard := range shards {
+		close(shard)
+	}
+	wg.Wait()
+}
+
+func keyShard(key string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
@@ -0,0 +1,90 @@
+package pubsub
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestRunWorkersKeepsKeyOrder(t *testing.T) {
+	const keys, perKey = 4, 25
+	msgs := make(chan amqp.Delivery)
+	go func() {
+		defer close(msgs)
+		for i := 0; i < perKey; i++ {
+			for k := 0; k < keys; k++ {
+				msgs <- amqp.Delivery{RoutingKey: fmt.Sprintf("army_moves.%d", k), Body: []byte(strconv.Itoa(i))}
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	seen := map[string][]int{}
+	runWorkers(msgs, 3, true, func(msg amqp.Delivery) {
+		time.Sleep(time.Duration(rand.Intn(200)) * time.Microsecond)
+		n, _ := strconv.Atoi(string(msg.Body))
+		mu.Lock()
+		seen[msg.RoutingKey] = append(seen[msg.RoutingKey], n)
+		mu.Unlock()
+	})
+	for key, order := range seen {
+		for i, n := range order {
+			if n != i {
+				t.Errorf("%s was handled in order %v", key, order)
+				break
+			}
+		}
+	}
+	if len(seen) != keys {
+		t.Errorf("handled %d keys, want %d", len(seen), keys)
+	}
+}
+
+// A retried delivery comes back through the default exchange and must
+// land on the worker of the key it was first published with.
+func TestRunWorkersShardsRetriesByOriginalKey(t *testing.T) {
+	original := amqp.Delivery{RoutingKey: "army_moves.alice"}
+	retried := amqp.Delivery{RoutingKey: "logs", Headers: amqp.Table{
+		OriginalExchangeHeader:   "topic",
+		OriginalRoutingKeyHeader: "army_moves.alice",
+	}}
+	if keyShard(restoreRoute(retried).RoutingKey, 8) != keyShard(original.RoutingKey, 8) {
+		t.Error("retried delivery is sharded apart from its original key")
+	}
+}
+
+func TestRunWorkersRunsConcurrently(t *testing.T) {
+	const n = 4
+	msgs := make(chan amqp.Delivery, n)
+	for i := 0; i < n; i++ {
+		msgs <- amqp.Delivery{}
+	}
+	close(msgs)
+
+	var wg sync.WaitGroup
+	wg.Add(n)
+	all := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(all)
+	}()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runWorkers(msgs, n, false, func(amqp.Delivery) {
+			// Every worker waits until all of them are busy at once.
+			wg.Done()
+			<-all
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(testTimeout):
+		t.Fatalf("%d workers did not handle messages concurrently", n)
+	}
+}
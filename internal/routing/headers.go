@@ -0,0 +1,24 @@
+package routing
+
+// Headers that Peril messages carry on ExchangePerilHeaders, so that
+// consumers can select traffic by attribute rather than by routing key.
+// Names must not start with "x-", which headers exchanges ignore.
+const (
+	HeaderPlayer   = "peril-player"
+	HeaderLocation = "peril-location"
+	// HeaderRankPrefix followed by a unit rank is true when a message
+	// involves units of that rank.
+	HeaderRankPrefix = "peril-rank-"
+)
+
+func PlayerHeader(username string) map[string]any {
+	return map[string]any{HeaderPlayer: username}
+}
+
+func LocationHeader(location string) map[string]any {
+	return map[string]any{HeaderLocation: location}
+}
+
+func RankHeader(rank string) map[string]any {
+	return map[string]any{HeaderRankPrefix + rank: true}
+}
@@ -6,8 +6,28 @@ type PlayingState struct {
 	IsPaused bool
 }
 
+type LogKind string
+
+const (
+	LogKindWar  LogKind = "war"
+	LogKindSpam LogKind = "spam"
+)
+
 type GameLog struct {
 	CurrentTime time.Time
 	Message     string
 	Username    string
+	Kind        LogKind
+}
+
+func (GameLog) SchemaVersion() int {
+	return 2
+}
+
+// GameLogV1 is GameLog before Kind was added. It is kept so that logs
+// still sitting in queues can be upcast.
+type GameLogV1 struct {
+	CurrentTime time.Time
+	Message     string
+	Username    string
 }
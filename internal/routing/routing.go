@@ -5,15 +5,52 @@ const (
 
 	WarRecognitionsPrefix = "war"
 
+	WarResolutionsPrefix = "war_resolutions"
+
+	SpawnsPrefix = "spawns"
+
+	// WorldEventsQueue feeds every spawn and army move to the server, in
+	// order, to keep its world state and decide wars.
+	WorldEventsQueue = "world_events"
+
+	WorldQueryKey = "rpc.world"
+
+	// Rejected actions are published with ViolationsPrefix and the
+	// offender's username, reaching both the offender and AuditQueue.
+	ViolationsPrefix = "violations"
+	AuditQueue       = "audit"
+
 	PauseKey = "pause"
 
+	PauseStateKey = "rpc.pause_state"
+
 	GameLogSlug = "game_logs"
 
-    PerilDlq = "peril_dlq"
+	PerilDlq = "peril_dlq"
 )
 
+// The server keeps every key in ServerKeyStoreFile, its own as
+// ServerSigner included. Players are issued their key by the server's
+// admin and keep only that one, in PlayerKeyFile.
+const (
+	ServerKeyStoreFile = "peril-server.keys"
+	ServerSigner       = "peril-server"
+)
+
+func PlayerKeyFile(username string) string {
+	return username + ".key"
+}
+
 const (
 	ExchangePerilDirect = "peril_direct"
 	ExchangePerilTopic  = "peril_topic"
-	ExchangePerilDlx  = "peril_dlx"
+	ExchangePerilDlx    = "peril_dlx"
+	// ExchangePerilHeaders routes on the headers in headers.go.
+	ExchangePerilHeaders = "peril_headers"
 )
+
+// WarResolutionKey addresses the server's verdict on a war to one of its
+// players. Each player consumes its own queue of the same name.
+func WarResolutionKey(username string) string {
+	return WarResolutionsPrefix + "." + username
+}
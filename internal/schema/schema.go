@@ -0,0 +1,28 @@
+// Package schema registers upcasters for Peril messages whose schema has
+// changed. Import it in every process that consumes those messages.
+package schema
+
+import (
+	"pubsub/internal/pubsub"
+	"pubsub/internal/routing"
+	"strings"
+)
+
+func init() {
+	pubsub.RegisterUpcaster(pubsub.DefaultUpcasters, pubsub.TypeName(routing.GameLog{}), 1, GameLogV1ToV2)
+}
+
+// GameLogV1ToV2 infers the kind of a v1 log from its text. Clients only
+// wrote war outcomes and spam before logs carried a kind.
+func GameLogV1ToV2(gl routing.GameLogV1) routing.GameLog {
+	kind := routing.LogKindSpam
+	if strings.Contains(gl.Message, " won a war against ") || strings.Contains(gl.Message, " resulted in a draw") {
+		kind = routing.LogKindWar
+	}
+	return routing.GameLog{
+		CurrentTime: gl.CurrentTime,
+		Message:     gl.Message,
+		Username:    gl.Username,
+		Kind:        kind,
+	}
+}
@@ -0,0 +1,20 @@
+package topology
+
+import (
+	_ "embed"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed peril.yaml
+var perilYAML []byte
+
+// Peril returns the topology shared by the Peril server and clients.
+// Per-player queues are declared by the clients themselves.
+func Peril() Spec {
+	var spec Spec
+	if err := yaml.Unmarshal(perilYAML, &spec); err != nil {
+		panic("Embedded Peril topology is invalid: " + err.Error())
+	}
+	return spec
+}
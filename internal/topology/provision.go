@@ -0,0 +1,218 @@
+package topology
+
+import (
+	"errors"
+	"fmt"
+	"pubsub/internal/pubsub"
+	"reflect"
+	"slices"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Provision declares everything in spec. Declarations are idempotent, so
+// it is safe to run on every start; it fails if an existing entity was
+// declared with different settings.
+func Provision(b pubsub.Broker, spec Spec) error {
+	if err := spec.Validate(); err != nil {
+		return fmt.Errorf("Invalid topology: %w", err)
+	}
+	ch, err := b.Channel()
+	if err != nil {
+		return fmt.Errorf("Channel creation failed: %w", err)
+	}
+	defer ch.Close()
+	for _, ex := range spec.Exchanges {
+		err := ch.ExchangeDeclare(ex.Name, ex.Type, ex.Durable, ex.AutoDelete, ex.Internal, false, table(ex.Args))
+		if err != nil {
+			return fmt.Errorf("Declaring exchange %s failed: %w", ex.Name, err)
+		}
+	}
+	for _, q := range spec.Queues {
+		_, err := ch.QueueDeclare(q.Name, q.Durable, q.AutoDelete, q.Exclusive, false, q.Table())
+		if err != nil {
+			return fmt.Errorf("Declaring queue %s failed: %w", q.Name, err)
+		}
+	}
+	for _, bnd := range spec.Bindings {
+		err := ch.QueueBind(bnd.Queue, bnd.Key, bnd.Exchange, false, table(bnd.Args))
+		if err != nil {
+			return fmt.Errorf("Binding %s failed: %w", bnd, err)
+		}
+	}
+	return nil
+}
+
+// Drift is a difference between the spec and the broker.
+type Drift struct {
+	Kind    string
+	Name    string
+	Problem string
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s %s: %s", d.Kind, d.Name, d.Problem)
+}
+
+// Verify reports exchanges and queues of the spec that are missing from
+// the broker, which it finds with passive declares. AMQP cannot report
+// the settings and arguments of existing entities or list bindings, so
+// those are only compared if ins is given. Verify never creates or
+// changes anything.
+func Verify(b pubsub.Broker, ins Inspector, spec Spec) ([]Drift, error) {
+	drifts := []Drift{}
+	missing := map[string]bool{}
+	for _, ex := range spec.Exchanges {
+		ok, err := exists(b, func(ch pubsub.Channel) error {
+			return ch.ExchangeDeclarePassive(ex.Name, ex.Type, ex.Durable, ex.AutoDelete, ex.Internal, false, nil)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Checking exchange %s failed: %w", ex.Name, err)
+		}
+		if !ok {
+			drifts = append(drifts, Drift{Kind: "exchange", Name: ex.Name, Problem: "missing"})
+			missing["exchange "+ex.Name] = true
+		}
+	}
+	for _, q := range spec.Queues {
+		ok, err := exists(b, func(ch pubsub.Channel) error {
+			_, err := ch.QueueDeclarePassive(q.Name, q.Durable, q.AutoDelete, q.Exclusive, false, nil)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Checking queue %s failed: %w", q.Name, err)
+		}
+		if !ok {
+			drifts = append(drifts, Drift{Kind: "queue", Name: q.Name, Problem: "missing"})
+			missing["queue "+q.Name] = true
+		}
+	}
+	if ins == nil {
+		return drifts, nil
+	}
+
+	current, err := ins.Definitions()
+	if err != nil {
+		return nil, err
+	}
+	exchanges := map[string]Exchange{}
+	for _, ex := range current.Exchanges {
+		exchanges[ex.Name] = ex
+	}
+	for _, want := range spec.Exchanges {
+		got, ok := exchanges[want.Name]
+		if !ok || missing["exchange "+want.Name] {
+			continue
+		}
+		for _, problem := range differences([]setting{
+			{"type", got.Type, want.Type},
+			{"durable", got.Durable, want.Durable},
+			{"auto_delete", got.AutoDelete, want.AutoDelete},
+			{"internal", got.Internal, want.Internal},
+		}, table(got.Args), table(want.Args)) {
+			drifts = append(drifts, Drift{Kind: "exchange", Name: want.Name, Problem: problem})
+		}
+	}
+	queues := map[string]Queue{}
+	for _, q := range current.Queues {
+		queues[q.Name] = q
+	}
+	for _, want := range spec.Queues {
+		got, ok := queues[want.Name]
+		if !ok || missing["queue "+want.Name] {
+			continue
+		}
+		for _, problem := range differences([]setting{
+			{"durable", got.Durable, want.Durable},
+			{"auto_delete", got.AutoDelete, want.AutoDelete},
+		}, got.Table(), want.Table()) {
+			drifts = append(drifts, Drift{Kind: "queue", Name: want.Name, Problem: problem})
+		}
+	}
+	for _, want := range spec.Bindings {
+		if !slices.ContainsFunc(current.Bindings, want.equal) {
+			drifts = append(drifts, Drift{Kind: "binding", Name: want.String(), Problem: "missing"})
+		}
+	}
+	inSpec := map[string]bool{}
+	for _, ex := range spec.Exchanges {
+		inSpec["exchange "+ex.Name] = true
+	}
+	for _, q := range spec.Queues {
+		inSpec["queue "+q.Name] = true
+	}
+	for _, got := range current.Bindings {
+		// Bindings to queues the spec does not own, such as the players'
+		// own queues, are none of its business.
+		if !inSpec["exchange "+got.Exchange] || !inSpec["queue "+got.Queue] {
+			continue
+		}
+		if !slices.ContainsFunc(spec.Bindings, got.equal) {
+			drifts = append(drifts, Drift{Kind: "binding", Name: got.String(), Problem: "not in spec"})
+		}
+	}
+	return drifts, nil
+}
+
+// exists runs a passive declare on a channel of its own, since the broker
+// closes the channel when the entity is missing.
+func exists(b pubsub.Broker, declare func(ch pubsub.Channel) error) (bool, error) {
+	ch, err := b.Channel()
+	if err != nil {
+		return false, fmt.Errorf("Channel creation failed: %w", err)
+	}
+	defer ch.Close()
+	err = declare(ch)
+	var amqpErr *amqp.Error
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, pubsub.ErrNotFound), errors.As(err, &amqpErr) && amqpErr.Code == amqp.NotFound:
+		return false, nil
+	}
+	return false, err
+}
+
+type setting struct {
+	name      string
+	got, want any
+}
+
+// differences describes every setting and x- argument that does not match.
+func differences(settings []setting, got, want amqp.Table) []string {
+	problems := []string{}
+	for _, s := range settings {
+		if s.got != s.want {
+			problems = append(problems, fmt.Sprintf("%s is %v, spec says %v", s.name, s.got, s.want))
+		}
+	}
+	keys := []string{}
+	for k := range got {
+		keys = append(keys, k)
+	}
+	for k := range want {
+		if _, ok := got[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		x, xok := got[k]
+		y, yok := want[k]
+		switch {
+		case !yok:
+			problems = append(problems, fmt.Sprintf("argument %s=%v is not in spec", k, x))
+		case !xok:
+			problems = append(problems, fmt.Sprintf("argument %s=%v is missing", k, y))
+		case !reflect.DeepEqual(value(x), value(y)):
+			problems = append(problems, fmt.Sprintf("argument %s is %v, spec says %v", k, x, y))
+		}
+	}
+	return problems
+}
+
+// equal compares bindings the way the broker identifies them.
+func (b Binding) equal(other Binding) bool {
+	return b.Exchange == other.Exchange && b.Queue == other.Queue && b.Key == other.Key &&
+		reflect.DeepEqual(table(b.Args), table(other.Args))
+}
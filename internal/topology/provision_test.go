@@ -0,0 +1,119 @@
+package topology
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pubsub/internal/pubsub"
+	"slices"
+	"testing"
+)
+
+// serveDefinitions answers like the management API would for spec.
+func serveDefinitions(t *testing.T, spec Spec) string {
+	t.Helper()
+	defs := map[string][]map[string]any{}
+	for _, ex := range spec.Exchanges {
+		defs["exchanges"] = append(defs["exchanges"], map[string]any{
+			"name": ex.Name, "type": ex.Type, "durable": ex.Durable,
+			"auto_delete": ex.AutoDelete, "internal": ex.Internal, "arguments": ex.Args,
+		})
+	}
+	for _, q := range spec.Queues {
+		defs["queues"] = append(defs["queues"], map[string]any{
+			"name": q.Name, "durable": q.Durable, "auto_delete": q.AutoDelete, "arguments": q.Table(),
+		})
+	}
+	for _, bnd := range spec.Bindings {
+		defs["bindings"] = append(defs["bindings"], map[string]any{
+			"source": bnd.Exchange, "destination": bnd.Queue, "destination_type": "queue",
+			"routing_key": bnd.Key, "arguments": bnd.Args,
+		})
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		if r.URL.EscapedPath() != "/api/definitions/%2F" || user != "guest" || password != "guest" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(defs)
+	}))
+	t.Cleanup(srv.Close)
+	return "http://guest:guest@" + srv.Listener.Addr().String()
+}
+
+// provisioned returns a broker holding the exchanges and queues of spec.
+func provisioned(t *testing.T, spec Spec) pubsub.Broker {
+	t.Helper()
+	b := pubsub.NewMemoryBroker()
+	if err := Provision(b, Spec{Exchanges: spec.Exchanges, Queues: spec.Queues}); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestVerifyMatchingBroker(t *testing.T) {
+	spec := Peril()
+	drifts, err := Verify(provisioned(t, spec), ManagementAPI{URL: serveDefinitions(t, spec)}, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Errorf("unexpected drift: %v", drifts)
+	}
+}
+
+func TestVerifyReportsDrift(t *testing.T) {
+	spec := Peril()
+	current := Peril()
+	current.Queues = slices.DeleteFunc(current.Queues, func(q Queue) bool { return q.Name == "audit" })
+	for i := range current.Queues {
+		if current.Queues[i].Name == "game_logs" {
+			current.Queues[i].MessageTTLMillis = 1000
+		}
+	}
+	current.Bindings = append(current.Bindings[1:],
+		Binding{Exchange: "peril_topic", Queue: "game_logs", Key: "#"},
+		// Players bind their own queues, which the spec does not own.
+		Binding{Exchange: "peril_topic", Queue: "army_move.alice", Key: "army_moves.*"},
+	)
+
+	drifts, err := Verify(provisioned(t, current), ManagementAPI{URL: serveDefinitions(t, current)}, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Drift{
+		{Kind: "queue", Name: "game_logs", Problem: "argument x-message-ttl=1000 is not in spec"},
+		{Kind: "queue", Name: "audit", Problem: "missing"},
+		{Kind: "binding", Name: spec.Bindings[0].String(), Problem: "missing"},
+		{Kind: "binding", Name: "peril_topic -> game_logs (#)", Problem: "not in spec"},
+	}
+	for _, d := range want {
+		if !slices.Contains(drifts, d) {
+			t.Errorf("missing drift %v in %v", d, drifts)
+		}
+	}
+	if len(drifts) != len(want) {
+		t.Errorf("got %d drifts, want %d: %v", len(drifts), len(want), drifts)
+	}
+}
+
+// Without the management API only missing entities can be found.
+func TestVerifyWithPassiveDeclares(t *testing.T) {
+	spec := Peril()
+	current := Peril()
+	current.Exchanges = current.Exchanges[1:]
+	current.Queues = slices.DeleteFunc(current.Queues, func(q Queue) bool { return q.Name == "audit" })
+
+	drifts, err := Verify(provisioned(t, current), nil, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Drift{
+		{Kind: "exchange", Name: spec.Exchanges[0].Name, Problem: "missing"},
+		{Kind: "queue", Name: "audit", Problem: "missing"},
+	}
+	if !slices.Equal(drifts, want) {
+		t.Errorf("got drifts %v, want %v", drifts, want)
+	}
+}
@@ -0,0 +1,158 @@
+package topology
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"pubsub/internal/pubsub"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"gopkg.in/yaml.v3"
+)
+
+// Spec describes every exchange, queue and binding an application needs.
+type Spec struct {
+	Exchanges []Exchange `json:"exchanges" yaml:"exchanges"`
+	Queues    []Queue    `json:"queues" yaml:"queues"`
+	Bindings  []Binding  `json:"bindings" yaml:"bindings"`
+}
+
+type Exchange struct {
+	Name       string         `json:"name" yaml:"name"`
+	Type       string         `json:"type" yaml:"type"`
+	Durable    bool           `json:"durable" yaml:"durable"`
+	AutoDelete bool           `json:"auto_delete,omitempty" yaml:"auto_delete,omitempty"`
+	Internal   bool           `json:"internal,omitempty" yaml:"internal,omitempty"`
+	Args       map[string]any `json:"args,omitempty" yaml:"args,omitempty"`
+}
+
+type Queue struct {
+	Name                 string         `json:"name" yaml:"name"`
+	Durable              bool           `json:"durable" yaml:"durable"`
+	AutoDelete           bool           `json:"auto_delete,omitempty" yaml:"auto_delete,omitempty"`
+	Exclusive            bool           `json:"exclusive,omitempty" yaml:"exclusive,omitempty"`
+	DeadLetterExchange   string         `json:"dead_letter_exchange,omitempty" yaml:"dead_letter_exchange,omitempty"`
+	DeadLetterRoutingKey string         `json:"dead_letter_routing_key,omitempty" yaml:"dead_letter_routing_key,omitempty"`
+	MessageTTLMillis     int64          `json:"message_ttl_ms,omitempty" yaml:"message_ttl_ms,omitempty"`
+	Args                 map[string]any `json:"args,omitempty" yaml:"args,omitempty"`
+}
+
+type Binding struct {
+	Exchange string         `json:"exchange" yaml:"exchange"`
+	Queue    string         `json:"queue" yaml:"queue"`
+	Key      string         `json:"key" yaml:"key"`
+	Args     map[string]any `json:"args,omitempty" yaml:"args,omitempty"`
+}
+
+// Load reads a spec from a .json, .yaml or .yml file.
+func Load(path string) (Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Spec{}, fmt.Errorf("Reading topology failed: %w", err)
+	}
+	var spec Spec
+	switch filepath.Ext(path) {
+	case ".json":
+		err = json.Unmarshal(data, &spec)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &spec)
+	default:
+		return Spec{}, fmt.Errorf("Unknown topology format %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return Spec{}, fmt.Errorf("Parsing topology %s failed: %w", path, err)
+	}
+	return spec, spec.Validate()
+}
+
+// Validate checks that the spec is self-consistent: names are unique,
+// exchange types are known and bindings refer to declared entities.
+func (s Spec) Validate() error {
+	var errs []error
+	exchanges := map[string]bool{}
+	for _, ex := range s.Exchanges {
+		if exchanges[ex.Name] {
+			errs = append(errs, fmt.Errorf("exchange %s is declared twice", ex.Name))
+		}
+		exchanges[ex.Name] = true
+		switch ex.Type {
+		case pubsub.Direct, pubsub.Fanout, pubsub.Topic, pubsub.Headers:
+		default:
+			errs = append(errs, fmt.Errorf("exchange %s has unknown type %q", ex.Name, ex.Type))
+		}
+	}
+	queues := map[string]bool{}
+	for _, q := range s.Queues {
+		if queues[q.Name] {
+			errs = append(errs, fmt.Errorf("queue %s is declared twice", q.Name))
+		}
+		queues[q.Name] = true
+		if q.DeadLetterExchange != "" && !exchanges[q.DeadLetterExchange] {
+			errs = append(errs, fmt.Errorf("queue %s dead-letters to undeclared exchange %s", q.Name, q.DeadLetterExchange))
+		}
+	}
+	for _, bnd := range s.Bindings {
+		if !exchanges[bnd.Exchange] {
+			errs = append(errs, fmt.Errorf("binding %s uses undeclared exchange", bnd))
+		}
+		if !queues[bnd.Queue] {
+			errs = append(errs, fmt.Errorf("binding %s uses undeclared queue", bnd))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (b Binding) String() string {
+	return fmt.Sprintf("%s -> %s (%s)", b.Exchange, b.Queue, b.Key)
+}
+
+// Table returns the queue's arguments with the dead-letter and TTL
+// settings folded in.
+func (q Queue) Table() amqp.Table {
+	t := table(q.Args)
+	if q.DeadLetterExchange != "" {
+		t["x-dead-letter-exchange"] = q.DeadLetterExchange
+	}
+	if q.DeadLetterRoutingKey != "" {
+		t["x-dead-letter-routing-key"] = q.DeadLetterRoutingKey
+	}
+	if q.MessageTTLMillis > 0 {
+		t["x-message-ttl"] = q.MessageTTLMillis
+	}
+	if len(t) == 0 {
+		return nil
+	}
+	return t
+}
+
+// table converts decoded YAML or JSON values into types AMQP can encode.
+func table(args map[string]any) amqp.Table {
+	t := amqp.Table{}
+	for k, v := range args {
+		t[k] = value(v)
+	}
+	return t
+}
+
+func value(v any) any {
+	switch v := v.(type) {
+	case int:
+		return int64(v)
+	case float64:
+		if v == float64(int64(v)) {
+			return int64(v)
+		}
+		return v
+	case map[string]any:
+		return table(v)
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = value(item)
+		}
+		return out
+	}
+	return v
+}